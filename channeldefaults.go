@@ -0,0 +1,39 @@
+package main
+
+import (
+	plugin "github.com/gotify/plugin-api"
+)
+
+// applyChannelDefaults applies the title prefix, default priority and default extras of a channel to a message
+func applyChannelDefaults(channel ChannelDef, msg plugin.Message, priority *int) plugin.Message {
+	msg.Title = channel.TitlePrefix + msg.Title
+	switch {
+	case priority != nil:
+		msg.Priority = *priority
+	case channel.DefaultPriority != nil:
+		msg.Priority = *channel.DefaultPriority
+	}
+	msg.Extras = mergeExtras(channel.DefaultExtras, msg.Extras)
+	return msg
+}
+
+// mergeExtras merges default extras into extras without modifying either, nested maps are merged key by key
+func mergeExtras(defaults map[string]interface{}, extras map[string]interface{}) map[string]interface{} {
+	if len(defaults) == 0 {
+		return extras
+	}
+	res := make(map[string]interface{}, len(defaults)+len(extras))
+	for k, v := range defaults {
+		res[k] = v
+	}
+	for k, v := range extras {
+		defaultMap, ok1 := res[k].(map[string]interface{})
+		valueMap, ok2 := v.(map[string]interface{})
+		if ok1 && ok2 {
+			res[k] = mergeExtras(defaultMap, valueMap)
+			continue
+		}
+		res[k] = v
+	}
+	return res
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	plugin "github.com/gotify/plugin-api"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChannelDefaults(t *testing.T) {
+	Convey("Test Channel Defaults", t, func(c C) {
+		priority := 7
+		channel := ChannelDef{
+			Name:            "alerts",
+			TitlePrefix:     "[alerts] ",
+			DefaultPriority: &priority,
+			DefaultExtras: map[string]interface{}{
+				"client::display":      map[string]interface{}{"contentType": "text/markdown"},
+				"client::notification": map[string]interface{}{"click": map[string]interface{}{"url": "https://status.example.com"}},
+			},
+		}
+		c.Convey("merges extras", func(c C) {
+			extras := map[string]interface{}{
+				"client::display": map[string]interface{}{"contentType": "text/plain"},
+				"custom::key":     "value",
+			}
+			merged := mergeExtras(channel.DefaultExtras, extras)
+			c.So(merged["client::display"], ShouldResemble, map[string]interface{}{"contentType": "text/plain"})
+			c.So(merged["client::notification"], ShouldResemble, channel.DefaultExtras["client::notification"])
+			c.So(merged["custom::key"], ShouldEqual, "value")
+			c.So(extras, ShouldHaveLength, 2)
+			c.So(mergeExtras(nil, extras), ShouldResemble, extras)
+		})
+		c.Convey("applies to messages", func(c C) {
+			msg := applyChannelDefaults(channel, plugin.Message{Title: "disk full"}, nil)
+			c.So(msg.Title, ShouldEqual, "[alerts] disk full")
+			c.So(msg.Priority, ShouldEqual, 7)
+			zero := 0
+			c.So(applyChannelDefaults(channel, plugin.Message{}, &zero).Priority, ShouldEqual, 0)
+			c.So(applyChannelDefaults(ChannelDef{}, plugin.Message{}, nil).Priority, ShouldEqual, 0)
+		})
+		c.Convey("applies through the webhook", func(c C) {
+			p, handler := newTestUser(c, "defaults", func(config *Config) {
+				config.Channels = []ChannelDef{channel}
+			})
+			engine := newTestWebhook(p)
+
+			c.So(postJSON(engine, "/message?channel=alerts", `{"title": "disk full", "message": "90%"}`, nil).Code, ShouldEqual, http.StatusOK)
+			c.So(postJSON(engine, "/message?channel=alerts", `{"title": "recovered", "message": "50%", "priority": 2}`, nil).Code, ShouldEqual, http.StatusOK)
+			for _, expected := range []struct {
+				title    string
+				priority int
+			}{{"[alerts] disk full", 7}, {"[alerts] recovered", 2}} {
+				select {
+				case msg := <-handler:
+					c.So(msg.Title, ShouldEqual, expected.title)
+					c.So(msg.Priority, ShouldEqual, expected.priority)
+					c.So(msg.Extras, ShouldContainKey, "client::notification")
+				case <-time.After(time.Second):
+					c.So("broadcast not delivered", ShouldBeEmpty)
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
+	"github.com/gotify/plugin-api"
+)
+
+const (
+	// CoalesceTitle fingerprints broadcasts by title.
+	CoalesceTitle CoalesceField = "title"
+	// CoalesceMessage fingerprints broadcasts by message text.
+	CoalesceMessage CoalesceField = "message"
+	// CoalescePriority fingerprints broadcasts by priority.
+	CoalescePriority CoalesceField = "priority"
+	// CoalesceChannel fingerprints broadcasts by channel name.
+	CoalesceChannel CoalesceField = "channel"
+)
+
+// CoalesceField is a field of a broadcast used to fingerprint repeated broadcasts
+type CoalesceField string
+
+// CoalesceConfig configures coalescing of repeated similar broadcasts from the same sender
+type CoalesceConfig struct {
+	// Window is how long repeats of a delivered broadcast are counted instead of delivered, zero disables coalescing
+	Window time.Duration `yaml:"window,omitempty"`
+	// Fields are the fields compared to decide whether broadcasts are similar, defaults to the title
+	Fields []CoalesceField `yaml:"fields,omitempty"`
+}
+
+// Check checks a CoalesceConfig for errors
+func (c CoalesceConfig) Check() error {
+	if c.Window < 0 {
+		return errors.New("coalesce window must not be negative")
+	}
+	for _, field := range c.Fields {
+		switch field {
+		case CoalesceTitle, CoalesceMessage, CoalescePriority, CoalesceChannel:
+		default:
+			return fmt.Errorf("unsupported coalesce field: %s", field)
+		}
+	}
+	return nil
+}
+
+func (c CoalesceConfig) fingerprint(msg model.Message) string {
+	fields := c.Fields
+	if len(fields) == 0 {
+		fields = []CoalesceField{CoalesceTitle}
+	}
+	parts := []string{strconv.FormatUint(uint64(msg.Sender.ID), 10)}
+	for _, field := range fields {
+		switch field {
+		case CoalesceTitle:
+			parts = append(parts, msg.Msg.Title)
+		case CoalesceMessage:
+			parts = append(parts, msg.Msg.Message)
+		case CoalescePriority:
+			parts = append(parts, strconv.Itoa(msg.Msg.Priority))
+		case CoalesceChannel:
+			parts = append(parts, msg.Channel.Name)
+		}
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// coalescer counts repeats of delivered broadcasts within their window
+type coalescer struct {
+	mutex   sync.Mutex
+	entries map[string]*coalesceEntry
+}
+
+type coalesceEntry struct {
+	first   model.Message
+	repeats int
+}
+
+// observe records a broadcast, it returns true if the broadcast repeats one delivered within the window
+// flush is called with the first broadcast and the number of repeats when the window ends
+func (c *coalescer) observe(config CoalesceConfig, msg model.Message, flush func(first model.Message, repeats int)) bool {
+	if config.Window <= 0 {
+		return false
+	}
+	key := config.fingerprint(msg)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if entry, ok := c.entries[key]; ok {
+		entry.repeats++
+		return true
+	}
+	if c.entries == nil {
+		c.entries = make(map[string]*coalesceEntry)
+	}
+	entry := &coalesceEntry{first: msg}
+	c.entries[key] = entry
+	time.AfterFunc(config.Window, func() {
+		c.mutex.Lock()
+		delete(c.entries, key)
+		repeats := entry.repeats
+		c.mutex.Unlock()
+		if repeats > 0 {
+			flush(entry.first, repeats)
+		}
+	})
+	return false
+}
+
+// sendRepeatSummary delivers the follow-up of a coalesced broadcast
+func (c *Plugin) sendRepeatSummary(window time.Duration) func(first model.Message, repeats int) {
+	return func(first model.Message, repeats int) {
+		state := c.loadState()
+		if !state.enabled || state.msgHandler == nil {
+			return
+		}
+		_ = state.msgHandler.SendMessage(plugin.Message{
+			Title:    first.Msg.Title,
+			Message:  fmt.Sprintf("%s: repeated %d more times in the last %s", first.Sender.Name, repeats, shortDuration(window)),
+			Priority: first.Msg.Priority,
+		})
+	}
+}
+
+// shortDuration formats a duration without trailing zero units, such as 10m instead of 10m0s
+func shortDuration(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = s[:len(s)-2]
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = s[:len(s)-2]
+	}
+	return s
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
+	plugin "github.com/gotify/plugin-api"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestCoalesceConfig(t *testing.T) {
+	Convey("Test Coalesce Config", t, func(c C) {
+		alice := plugin.UserContext{ID: 1, Name: "alice"}
+		bob := plugin.UserContext{ID: 2, Name: "bob"}
+		c.Convey("fingerprint", func(c C) {
+			config := CoalesceConfig{}
+			c.So(config.fingerprint(model.Message{Sender: alice, Msg: plugin.Message{Title: "disk full", Message: "a"}}),
+				ShouldEqual, config.fingerprint(model.Message{Sender: alice, Msg: plugin.Message{Title: "disk full", Message: "b"}}))
+			c.So(config.fingerprint(model.Message{Sender: alice, Msg: plugin.Message{Title: "disk full"}}),
+				ShouldNotEqual, config.fingerprint(model.Message{Sender: bob, Msg: plugin.Message{Title: "disk full"}}))
+			config.Fields = []CoalesceField{CoalesceTitle, CoalesceMessage}
+			c.So(config.fingerprint(model.Message{Sender: alice, Msg: plugin.Message{Title: "disk full", Message: "a"}}),
+				ShouldNotEqual, config.fingerprint(model.Message{Sender: alice, Msg: plugin.Message{Title: "disk full", Message: "b"}}))
+		})
+		c.Convey("check", func(c C) {
+			c.So(CoalesceConfig{}.Check(), ShouldBeNil)
+			c.So(CoalesceConfig{Window: -time.Minute}.Check(), ShouldNotBeNil)
+			c.So(CoalesceConfig{Window: time.Minute, Fields: []CoalesceField{"extras"}}.Check(), ShouldNotBeNil)
+			c.So(CoalesceConfig{Window: time.Minute, Fields: []CoalesceField{CoalesceChannel, CoalescePriority}}.Check(), ShouldBeNil)
+		})
+		c.Convey("duration", func(c C) {
+			c.So(shortDuration(10*time.Minute), ShouldEqual, "10m")
+			c.So(shortDuration(2*time.Hour), ShouldEqual, "2h")
+			c.So(shortDuration(90*time.Second), ShouldEqual, "1m30s")
+		})
+	})
+}
+
+func TestCoalesceDelivery(t *testing.T) {
+	Convey("Test Coalesce Delivery", t, func(c C) {
+		p := &Plugin{UserCtx: plugin.UserContext{ID: 9001, Name: "coalesce"}}
+		p.SetStorageHandler(new(memoryStorage))
+		handler := make(recordingHandler, 10)
+		p.SetMessageHandler(handler)
+		config := p.DefaultConfig().(*Config)
+		config.Coalesce = CoalesceConfig{Window: 100 * time.Millisecond}
+		c.So(p.ValidateAndSetConfig(config), ShouldBeNil)
+		c.So(p.Enable(), ShouldBeNil)
+
+		sender := plugin.UserContext{ID: 1, Name: "alice"}
+		msg := model.Message{Sender: sender, Msg: plugin.Message{Title: "disk full", Priority: 5}}
+		c.So(p.screenMessage(msg), ShouldEqual, StatusDelivered)
+		c.So(p.screenMessage(msg), ShouldEqual, StatusCoalesced)
+		c.So(p.screenMessage(msg), ShouldEqual, StatusCoalesced)
+		c.So(p.screenMessage(model.Message{Sender: sender, Msg: plugin.Message{Title: "cpu hot"}}), ShouldEqual, StatusDelivered)
+
+		select {
+		case summary := <-handler:
+			c.So(summary.Title, ShouldEqual, "disk full")
+			c.So(summary.Message, ShouldContainSubstring, "repeated 2 more times in the last 100ms")
+			c.So(summary.Priority, ShouldEqual, 5)
+		case <-time.After(time.Second):
+			c.So("no summary delivered", ShouldBeEmpty)
+		}
+		time.Sleep(50 * time.Millisecond)
+		c.So(handler, ShouldBeEmpty)
+		c.So(p.screenMessage(msg), ShouldEqual, StatusDelivered)
+	})
+}
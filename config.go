@@ -1,22 +1,81 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
 	"github.com/eternal-flame-AD/gotify-broadcast/rules"
 )
 
 // ChannelDef is the definition of a channel in the configuration
-type ChannelDef struct {
-	Name   string `yaml:"name"`
-	Public bool   `yaml:"public"`
+type ChannelDef = model.ChannelDef
+
+// ChannelInfo is the public part of a channel definition carried by broadcasts
+type ChannelInfo = model.ChannelInfo
+
+// DeliveryConfig configures how received broadcasts are queued before delivery
+type DeliveryConfig struct {
+	QueueSize int            `yaml:"queue_size,omitempty"`
+	Timeout   time.Duration  `yaml:"timeout,omitempty"`
+	Overflow  OverflowPolicy `yaml:"overflow,omitempty"`
+}
+
+func (c DeliveryConfig) withDefaults() DeliveryConfig {
+	if c.QueueSize == 0 {
+		c.QueueSize = defaultQueueSize
+	}
+	if c.Timeout == 0 {
+		c.Timeout = defaultDeliveryTimeout
+	}
+	if c.Overflow == "" {
+		c.Overflow = defaultOverflowPolicy
+	}
+	return c
+}
+
+// Check checks a DeliveryConfig for errors
+func (c DeliveryConfig) Check() error {
+	if c.QueueSize < 0 {
+		return errors.New("delivery queue size must not be negative")
+	}
+	if c.Timeout < 0 {
+		return errors.New("delivery timeout must not be negative")
+	}
+	switch c.Overflow {
+	case "", OverflowDropOldest, OverflowDropNewest, OverflowBlock:
+	default:
+		return fmt.Errorf("unsupported overflow policy: %s", c.Overflow)
+	}
+	return nil
 }
 
 // Config is user plugin configuration
 type Config struct {
-	Channels       []ChannelDef    `yaml:"channels"`
-	SenderFilter   rules.RuleChain `yaml:"sender_filter"`
-	ReceiverFilter rules.RuleChain `yaml:"receiver_filter"`
+	Channels       []ChannelDef       `yaml:"channels"`
+	SenderFilter   rules.RuleChain    `yaml:"sender_filter"`
+	ReceiverFilter rules.RuleChain    `yaml:"receiver_filter"`
+	Delivery       DeliveryConfig     `yaml:"delivery"`
+	OfflineQueue   OfflineQueueConfig `yaml:"offline_queue"`
+
+	DuplicateSuppression DuplicateSuppressionConfig `yaml:"duplicate_suppression"`
+	// MaxAge discards received broadcasts older than this when they are delivered late, zero accepts any age
+	MaxAge     time.Duration    `yaml:"max_age,omitempty"`
+	Digest     DigestConfig     `yaml:"digest"`
+	QuietHours QuietHoursConfig `yaml:"quiet_hours"`
+	Coalesce   CoalesceConfig   `yaml:"coalesce"`
+	// Template overrides the wrapper of received broadcasts
+	Template TemplateConfig `yaml:"template"`
+	// ForceMarkdown displays all received broadcasts as markdown
+	ForceMarkdown bool `yaml:"force_markdown,omitempty"`
+	// HideFooter leaves out the default footer, the broadcast is still described in the broadcast::meta extras
+	HideFooter bool `yaml:"hide_footer,omitempty"`
+	// ReceiveMode chooses between receiving all broadcasts and only those of subscribed channels
+	ReceiveMode   ReceiveMode `yaml:"receive_mode,omitempty"`
+	Subscriptions []string    `yaml:"subscriptions,omitempty"`
+	// ServerQuota is a ceiling on the quota of every channel on the server, only admins may set it
+	ServerQuota Quota `yaml:"server_quota,omitempty"`
 }
 
 // DefaultConfig implements plugin.Configurer
@@ -80,6 +139,8 @@ func (c *Plugin) DefaultConfig() interface{} {
 				Action: rules.Accept,
 			},
 		},
+		Delivery:     DeliveryConfig{}.withDefaults(),
+		OfflineQueue: OfflineQueueConfig{}.withDefaults(),
 	}
 }
 
@@ -87,9 +148,36 @@ func (c *Plugin) DefaultConfig() interface{} {
 func (c *Plugin) ValidateAndSetConfig(config interface{}) error {
 	newConfig := config.(*Config)
 
+	if err := newConfig.SenderFilter.Check(rules.Digest); err != nil {
+		return err
+	}
 	if err := newConfig.ReceiverFilter.Check(); err != nil {
 		return err
 	}
+	if err := newConfig.Delivery.Check(); err != nil {
+		return err
+	}
+	if err := newConfig.OfflineQueue.Check(); err != nil {
+		return err
+	}
+	if newConfig.MaxAge < 0 {
+		return errors.New("max age must not be negative")
+	}
+	if err := newConfig.Digest.Check(); err != nil {
+		return err
+	}
+	if err := newConfig.QuietHours.Check(); err != nil {
+		return err
+	}
+	if err := newConfig.Coalesce.Check(); err != nil {
+		return err
+	}
+	if err := checkSubscriptions(newConfig.ReceiveMode, newConfig.Subscriptions); err != nil {
+		return err
+	}
+	if err := newConfig.Template.Check(); err != nil {
+		return err
+	}
 
 	channels := make(map[string]struct{})
 	for _, ch := range newConfig.Channels {
@@ -97,9 +185,39 @@ func (c *Plugin) ValidateAndSetConfig(config interface{}) error {
 			return fmt.Errorf("channel name %s is duplicated", ch.Name)
 		}
 		channels[ch.Name] = struct{}{}
+		if err := model.CheckChannelName(ch.Name); err != nil {
+			return err
+		}
+		if ch.DedupWindow < 0 {
+			return fmt.Errorf("dedup window of channel %s must not be negative", ch.Name)
+		}
+		if err := checkQuota(ch.Quota); err != nil {
+			return fmt.Errorf("channel %s: %v", ch.Name, err)
+		}
+		if ch.ModerationTimeout < 0 {
+			return fmt.Errorf("moderation timeout of channel %s must not be negative", ch.Name)
+		}
+		if err := checkMembers(ch); err != nil {
+			return err
+		}
+		if err := checkChannelTemplates(ch); err != nil {
+			return err
+		}
+	}
+	if err := checkQuota(newConfig.ServerQuota); err != nil {
+		return err
+	}
+	if newConfig.ServerQuota != (Quota{}) && !c.UserCtx.Admin {
+		return errors.New("only admins may set a server quota")
 	}
 
 	publicChannels.UpdateChannelsForUser(c.UserCtx, newConfig.Channels)
-	c.config = newConfig
+	publicChannels.UpdateSubscriptionsForUser(c.UserCtx, newConfig.Subscriptions)
+	msgExchanger.SetDeliveryConfig(c.UserCtx.ID, newConfig.Delivery)
+	serverQuota.set(c.UserCtx.ID, newConfig.ServerQuota)
+	c.updateState(func(state *pluginState) {
+		state.config = newConfig
+	})
+	c.wakeScheduler()
 	return nil
 }
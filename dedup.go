@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	plugin "github.com/gotify/plugin-api"
+)
+
+const defaultDedupWindow = 10 * time.Minute
+
+// dedupCache remembers values by key for a limited time
+type dedupCache struct {
+	mutex   sync.Mutex
+	entries map[string]*dedupEntry
+}
+
+// dedupEntry is a cached value, done is closed once the value is created
+type dedupEntry struct {
+	done    chan struct{}
+	value   interface{}
+	err     error
+	expires time.Time
+}
+
+func (c *dedupEntry) created() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// lookupOrStore returns the unexpired value stored under key, or stores the value created by create.
+// create runs without holding the cache lock, concurrent callers with the same key wait for it.
+// A value created with an error is not stored, so the next caller creates it again.
+func (c *dedupCache) lookupOrStore(key string, ttl time.Duration, create func() (interface{}, error)) (value interface{}, found bool, err error) {
+	for {
+		c.mutex.Lock()
+		now := time.Now()
+		if c.entries == nil {
+			c.entries = make(map[string]*dedupEntry)
+		}
+		for k, entry := range c.entries {
+			if entry.created() && !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+		entry, ok := c.entries[key]
+		if !ok {
+			entry = &dedupEntry{done: make(chan struct{})}
+			c.entries[key] = entry
+		}
+		c.mutex.Unlock()
+
+		if ok {
+			<-entry.done
+			if entry.err != nil {
+				// the first caller failed and removed the entry, try to create the value again
+				continue
+			}
+			return entry.value, true, nil
+		}
+
+		entry.value, entry.err = create()
+		c.mutex.Lock()
+		if entry.err != nil {
+			delete(c.entries, key)
+		} else {
+			entry.expires = time.Now().Add(ttl)
+		}
+		close(entry.done)
+		c.mutex.Unlock()
+		return entry.value, false, entry.err
+	}
+}
+
+// DuplicateSuppressionConfig configures suppression of identical broadcasts on the receiver side
+type DuplicateSuppressionConfig struct {
+	// Window is how long an identical title and text is suppressed after it is first received, zero disables suppression
+	Window time.Duration `yaml:"window,omitempty"`
+}
+
+// once returns the value created by create, unless a value of the same kind was created with the same key for the channel of owner
+// within the dedup window, in which case that value is returned. A value created with an error is not remembered.
+func (c *Plugin) once(owner plugin.UserContext, channel ChannelDef, kind string, key string, create func() (interface{}, error)) (value interface{}, duplicated bool, err error) {
+	window := channel.DedupWindow
+	if window == 0 {
+		window = defaultDedupWindow
+	}
+	return c.sentBroadcasts.lookupOrStore(fmt.Sprintf("%s\x00%d\x00%s\x00%s", kind, owner.ID, channel.Name, key), window, create)
+}
+
+// sendMessageOnce sends a broadcast unless another one with the same key is sent through the channel of owner within the dedup window,
+// in which case the report of the original broadcast is returned. A broadcast refused with an error is not remembered.
+func (c *Plugin) sendMessageOnce(owner plugin.UserContext, channel ChannelDef, key string, send func() (*DeliveryReport, error)) (report *DeliveryReport, duplicated bool, err error) {
+	value, duplicated, err := c.once(owner, channel, "broadcast", key, func() (interface{}, error) {
+		return send()
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return value.(*DeliveryReport), duplicated, nil
+}
+
+// scheduleBroadcastOnce schedules a broadcast unless another one with the same key is scheduled for the channel of owner within the dedup window,
+// in which case the original scheduled broadcast is returned.
+func (c *Plugin) scheduleBroadcastOnce(owner plugin.UserContext, channel ChannelDef, key string, schedule func() (ScheduledBroadcast, error)) (job ScheduledBroadcast, duplicated bool, err error) {
+	value, duplicated, err := c.once(owner, channel, "scheduled", key, func() (interface{}, error) {
+		return schedule()
+	})
+	if err != nil {
+		return job, false, err
+	}
+	return value.(ScheduledBroadcast), duplicated, nil
+}
+
+// isDuplicate reports whether a broadcast with the same title and text was received within the window
+func (c *Plugin) isDuplicate(title, text string, window time.Duration) bool {
+	if window <= 0 {
+		return false
+	}
+	fingerprint := sha256.Sum256([]byte(title + "\x00" + text))
+	_, found, _ := c.recvBroadcasts.lookupOrStore(hex.EncodeToString(fingerprint[:]), window, func() (interface{}, error) {
+		return nil, nil
+	})
+	return found
+}
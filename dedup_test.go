@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
+	plugin "github.com/gotify/plugin-api"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDedupCache(t *testing.T) {
+	Convey("Test Dedup Cache", t, func(c C) {
+		cache := new(dedupCache)
+		created := 0
+		create := func() (interface{}, error) {
+			created++
+			return created, nil
+		}
+		value, found, err := cache.lookupOrStore("key", time.Hour, create)
+		c.So(err, ShouldBeNil)
+		c.So(found, ShouldBeFalse)
+		c.So(value, ShouldEqual, 1)
+		value, found, _ = cache.lookupOrStore("key", time.Hour, create)
+		c.So(found, ShouldBeTrue)
+		c.So(value, ShouldEqual, 1)
+		_, found, _ = cache.lookupOrStore("expiring", time.Millisecond, create)
+		c.So(found, ShouldBeFalse)
+		time.Sleep(10 * time.Millisecond)
+		value, found, _ = cache.lookupOrStore("expiring", time.Millisecond, create)
+		c.So(found, ShouldBeFalse)
+		c.So(value, ShouldEqual, 3)
+
+		c.Convey("does not store errors", func(c C) {
+			_, _, err := cache.lookupOrStore("failing", time.Hour, func() (interface{}, error) {
+				return nil, errors.New("failed")
+			})
+			c.So(err, ShouldNotBeNil)
+			value, found, err := cache.lookupOrStore("failing", time.Hour, create)
+			c.So(err, ShouldBeNil)
+			c.So(found, ShouldBeFalse)
+			c.So(value, ShouldEqual, 4)
+		})
+		c.Convey("does not hold other keys while creating", func(c C) {
+			release := make(chan struct{})
+			started := make(chan struct{})
+			go func() {
+				_, _, _ = cache.lookupOrStore("slow", time.Hour, func() (interface{}, error) {
+					close(started)
+					<-release
+					return "slow", nil
+				})
+			}()
+			<-started
+			_, found, _ := cache.lookupOrStore("other", time.Hour, create)
+			c.So(found, ShouldBeFalse)
+
+			waited := make(chan interface{})
+			go func() {
+				value, _, _ := cache.lookupOrStore("slow", time.Hour, create)
+				waited <- value
+			}()
+			close(release)
+			c.So(<-waited, ShouldEqual, "slow")
+		})
+	})
+}
+
+func TestDuplicateSuppression(t *testing.T) {
+	Convey("Test Duplicate Suppression", t, func(c C) {
+		p := &Plugin{UserCtx: plugin.UserContext{ID: 5002}}
+		c.So(p.isDuplicate("title", "text", 0), ShouldBeFalse)
+		c.So(p.isDuplicate("title", "text", 0), ShouldBeFalse)
+		c.So(p.isDuplicate("title", "text", time.Hour), ShouldBeFalse)
+		c.So(p.isDuplicate("title", "text", time.Hour), ShouldBeTrue)
+		c.So(p.isDuplicate("title", "other text", time.Hour), ShouldBeFalse)
+	})
+}
+
+func TestSendMessageOnce(t *testing.T) {
+	Convey("Test Send Message Once", t, func(c C) {
+		p := &Plugin{UserCtx: plugin.UserContext{ID: 5003, Name: "poster"}}
+		sent := 0
+		send := func() (*DeliveryReport, error) {
+			sent++
+			return newDeliveryReport(model.NewID()), nil
+		}
+		channel := ChannelDef{Name: "alerts"}
+		first, duplicated, _ := p.sendMessageOnce(p.UserCtx, channel, "key", send)
+		c.So(duplicated, ShouldBeFalse)
+		report, duplicated, _ := p.sendMessageOnce(p.UserCtx, channel, "key", send)
+		c.So(duplicated, ShouldBeTrue)
+		c.So(report, ShouldEqual, first)
+		_, duplicated, _ = p.sendMessageOnce(plugin.UserContext{ID: 5004, Name: "alice"}, channel, "key", send)
+		c.So(duplicated, ShouldBeFalse)
+		c.So(sent, ShouldEqual, 2)
+
+		_, _, err := p.sendMessageOnce(p.UserCtx, channel, "refused", func() (*DeliveryReport, error) {
+			return nil, errRateLimited{time.Minute}
+		})
+		c.So(err, ShouldNotBeNil)
+		_, duplicated, err = p.sendMessageOnce(p.UserCtx, channel, "refused", send)
+		c.So(err, ShouldBeNil)
+		c.So(duplicated, ShouldBeFalse)
+	})
+}
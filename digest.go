@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"text/template"
+	"time"
+
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
+	"github.com/gotify/plugin-api"
+)
+
+const defaultDigestInterval = time.Hour
+
+var defaultDigestTemplate = template.Must(template.New("digest").Parse(digestTemplateText))
+
+const digestTemplateText = `{{range .Groups}}[{{.Channel}}] {{.Sender}}:
+{{range .Messages}}- {{if .Msg.Title}}{{.Msg.Title}}: {{end}}{{.Msg.Message}}
+{{end}}
+{{end}}`
+
+// DigestConfig configures the digest collecting broadcasts matched by a digest action in the sender filter
+type DigestConfig struct {
+	// Interval delivers the digest periodically, defaults to an hour unless At is set
+	Interval time.Duration `yaml:"interval,omitempty"`
+	// At delivers the digest at fixed times of the day, formatted as 15:04
+	At []string `yaml:"at,omitempty"`
+	// Template renders the digest body, see digestData for available fields
+	Template string `yaml:"template,omitempty"`
+}
+
+// Check checks a DigestConfig for errors
+func (c DigestConfig) Check() error {
+	if c.Interval < 0 {
+		return errors.New("digest interval must not be negative")
+	}
+	for _, at := range c.At {
+		if _, err := time.Parse("15:04", at); err != nil {
+			return fmt.Errorf("invalid digest time %s, expected HH:MM", at)
+		}
+	}
+	_, err := c.template()
+	return err
+}
+
+func (c DigestConfig) template() (*template.Template, error) {
+	if c.Template == "" {
+		return defaultDigestTemplate, nil
+	}
+	tmpl, err := template.New("digest").Funcs(templateFuncs).Parse(c.Template)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTemplate(tmpl, reflect.TypeOf(digestData{})); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// next returns the first delivery time after last
+func (c DigestConfig) next(last time.Time) time.Time {
+	if len(c.At) == 0 {
+		interval := c.Interval
+		if interval == 0 {
+			interval = defaultDigestInterval
+		}
+		return last.Add(interval)
+	}
+	var res time.Time
+	for _, at := range c.At {
+		clock, err := time.Parse("15:04", at)
+		if err != nil {
+			continue
+		}
+		t := time.Date(last.Year(), last.Month(), last.Day(), clock.Hour(), clock.Minute(), 0, 0, last.Location())
+		if !t.After(last) {
+			t = t.AddDate(0, 0, 1)
+		}
+		if res.IsZero() || t.Before(res) {
+			res = t
+		}
+	}
+	return res
+}
+
+// digestGroup is the broadcasts in a digest sent by a user through a channel
+type digestGroup struct {
+	Channel  string
+	Sender   string
+	Messages []model.Message
+}
+
+// digestData is the data the digest template is executed with
+type digestData struct {
+	Count  int
+	Groups []digestGroup
+}
+
+func newDigestData(msgs []model.Message) digestData {
+	res := digestData{Count: len(msgs)}
+	index := make(map[[2]string]int)
+	for _, msg := range msgs {
+		key := [2]string{msg.Channel.Name, msg.Sender.Name}
+		i, ok := index[key]
+		if !ok {
+			i = len(res.Groups)
+			index[key] = i
+			res.Groups = append(res.Groups, digestGroup{Channel: key[0], Sender: key[1]})
+		}
+		res.Groups[i].Messages = append(res.Groups[i].Messages, msg)
+	}
+	sort.SliceStable(res.Groups, func(i, j int) bool {
+		if res.Groups[i].Channel != res.Groups[j].Channel {
+			return res.Groups[i].Channel < res.Groups[j].Channel
+		}
+		return res.Groups[i].Sender < res.Groups[j].Sender
+	})
+	return res
+}
+
+func renderDigest(config DigestConfig, msgs []model.Message) (plugin.Message, error) {
+	tmpl, err := config.template()
+	if err != nil {
+		return plugin.Message{}, err
+	}
+	body := bytes.NewBuffer([]byte{})
+	if err := tmpl.Execute(body, newDigestData(msgs)); err != nil {
+		return plugin.Message{}, err
+	}
+	priority := 0
+	for _, msg := range msgs {
+		if msg.Msg.Priority > priority {
+			priority = msg.Msg.Priority
+		}
+	}
+	return plugin.Message{
+		Title:    fmt.Sprintf("Digest: %d broadcasts", len(msgs)),
+		Message:  body.String(),
+		Priority: priority,
+	}, nil
+}
+
+// queueDigest adds a broadcast to the digest
+func (c *Plugin) queueDigest(msg model.Message) {
+	config := c.loadState().config.Digest
+	now := time.Now()
+	_ = c.storage.update(func(data *storedData) {
+		// after the digest was empty for longer than its interval the next delivery time is already past,
+		// start counting from the first broadcast again so that it is not delivered as a digest on its own
+		if len(data.Digest) == 0 && (data.DigestSentAt.IsZero() || !config.next(data.DigestSentAt).After(now)) {
+			data.DigestSentAt = now
+		}
+		data.Digest = append(data.Digest, msg)
+	})
+	c.wakeScheduler()
+}
+
+// nextDigest returns the next time the digest is due, ok is false if the digest is empty
+func (c *Plugin) nextDigest() (next time.Time, ok bool) {
+	config := c.loadState().config.Digest
+	c.storage.view(func(data *storedData) {
+		if len(data.Digest) > 0 {
+			next, ok = config.next(data.DigestSentAt), true
+		}
+	})
+	return
+}
+
+// flushDigest delivers the digest if it is due at now
+func (c *Plugin) flushDigest(now time.Time) {
+	state := c.loadState()
+	if !state.enabled || state.msgHandler == nil {
+		return
+	}
+	if next, ok := c.nextDigest(); !ok || next.After(now) {
+		return
+	}
+	var msgs []model.Message
+	_ = c.storage.update(func(data *storedData) {
+		for _, msg := range data.Digest {
+			if !isStale(state.config, msg, now) {
+				msgs = append(msgs, msg)
+			}
+		}
+		data.Digest = nil
+		data.DigestSentAt = now
+	})
+	if len(msgs) == 0 {
+		return
+	}
+	if digest, err := renderDigest(state.config.Digest, msgs); err == nil {
+		_ = state.msgHandler.SendMessage(digest)
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
+	"github.com/eternal-flame-AD/gotify-broadcast/rules"
+	plugin "github.com/gotify/plugin-api"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestDigestConfig(t *testing.T) {
+	Convey("Test Digest Config", t, func(c C) {
+		last := time.Date(2020, time.January, 1, 12, 30, 0, 0, time.UTC)
+		c.Convey("default interval", func(c C) {
+			c.So(DigestConfig{}.next(last), ShouldEqual, last.Add(time.Hour))
+		})
+		c.Convey("interval", func(c C) {
+			c.So(DigestConfig{Interval: 15 * time.Minute}.next(last), ShouldEqual, last.Add(15*time.Minute))
+		})
+		c.Convey("fixed times", func(c C) {
+			config := DigestConfig{At: []string{"09:00", "17:00"}}
+			c.So(config.next(last), ShouldEqual, time.Date(2020, time.January, 1, 17, 0, 0, 0, time.UTC))
+			c.So(config.next(config.next(last)), ShouldEqual, time.Date(2020, time.January, 2, 9, 0, 0, 0, time.UTC))
+		})
+		c.Convey("check", func(c C) {
+			c.So(DigestConfig{At: []string{"9am"}}.Check(), ShouldNotBeNil)
+			c.So(DigestConfig{Template: "{{.Count"}.Check(), ShouldNotBeNil)
+			c.So(DigestConfig{Interval: -time.Minute}.Check(), ShouldNotBeNil)
+			c.So(DigestConfig{At: []string{"09:00"}, Template: "{{.Count}}"}.Check(), ShouldBeNil)
+		})
+	})
+}
+
+func TestRenderDigest(t *testing.T) {
+	Convey("Test Rendering Digest", t, func(c C) {
+		newMsg := func(channel, sender, title string, priority int) model.Message {
+			return model.Message{
+				Channel: ChannelInfo{Name: channel},
+				Sender:  plugin.UserContext{Name: sender},
+				Msg:     plugin.Message{Title: title, Message: "text", Priority: priority},
+			}
+		}
+		msgs := []model.Message{
+			newMsg("ops", "bob", "first", 1),
+			newMsg("dev", "alice", "second", 3),
+			newMsg("ops", "bob", "third", 2),
+		}
+		data := newDigestData(msgs)
+		c.So(data.Count, ShouldEqual, 3)
+		c.So(data.Groups, ShouldHaveLength, 2)
+		c.So(data.Groups[0].Channel, ShouldEqual, "dev")
+		c.So(data.Groups[1].Messages, ShouldHaveLength, 2)
+
+		digest, err := renderDigest(DigestConfig{}, msgs)
+		c.So(err, ShouldBeNil)
+		c.So(digest.Title, ShouldContainSubstring, "3 broadcasts")
+		c.So(digest.Priority, ShouldEqual, 3)
+		c.So(digest.Message, ShouldContainSubstring, "[ops] bob:\n- first: text\n- third: text\n")
+
+		digest, err = renderDigest(DigestConfig{Template: "{{.Count}} in {{len .Groups}} groups"}, msgs)
+		c.So(err, ShouldBeNil)
+		c.So(digest.Message, ShouldEqual, "3 in 2 groups")
+	})
+}
+
+func TestDigestDelivery(t *testing.T) {
+	Convey("Test Digest Delivery", t, func(c C) {
+		p := &Plugin{UserCtx: plugin.UserContext{ID: 7001, Name: "digest"}}
+		p.SetStorageHandler(new(memoryStorage))
+		handler := make(recordingHandler, 10)
+		p.SetMessageHandler(handler)
+		config := p.DefaultConfig().(*Config)
+		threshold := 4
+		config.SenderFilter = rules.RuleChain{{
+			Match:  rules.MatchSet{{Mode: rules.ModePriorityLt, MessagePriority: &threshold}},
+			Action: rules.Digest,
+		}}
+		c.So(p.ValidateAndSetConfig(config), ShouldBeNil)
+		c.So(p.Enable(), ShouldBeNil)
+
+		low := model.Message{Channel: ChannelInfo{Name: "ops"}, Msg: plugin.Message{Title: "low", Priority: 1}, Timestamp: time.Now()}
+		high := model.Message{Channel: ChannelInfo{Name: "ops"}, Msg: plugin.Message{Title: "high", Priority: 8}, Timestamp: time.Now()}
+		c.So(p.screenMessage(low), ShouldEqual, StatusDigested)
+		c.So(p.screenMessage(high), ShouldEqual, StatusDelivered)
+
+		next, ok := p.nextDigest()
+		c.So(ok, ShouldBeTrue)
+		p.flushDigest(next.Add(-time.Second))
+		c.So(handler, ShouldBeEmpty)
+		p.flushDigest(next)
+		c.So(handler, ShouldHaveLength, 1)
+		c.So((<-handler).Message, ShouldContainSubstring, "low")
+		_, ok = p.nextDigest()
+		c.So(ok, ShouldBeFalse)
+
+		c.Convey("after an idle gap", func(c C) {
+			_ = p.storage.update(func(data *storedData) {
+				data.DigestSentAt = time.Now().Add(-3 * defaultDigestInterval)
+			})
+			c.So(p.screenMessage(low), ShouldEqual, StatusDigested)
+			next, ok := p.nextDigest()
+			c.So(ok, ShouldBeTrue)
+			c.So(next.After(time.Now().Add(defaultDigestInterval/2)), ShouldBeTrue)
+			p.flushDigest(time.Now())
+			c.So(handler, ShouldBeEmpty)
+		})
+		c.Convey("shortly after a delivery", func(c C) {
+			sentAt := time.Now().Add(-defaultDigestInterval / 2)
+			_ = p.storage.update(func(data *storedData) {
+				data.DigestSentAt = sentAt
+			})
+			c.So(p.screenMessage(low), ShouldEqual, StatusDigested)
+			next, _ := p.nextDigest()
+			c.So(next, ShouldEqual, sentAt.Add(defaultDigestInterval))
+		})
+	})
+	Convey("Test Digest Action Is Only Allowed In Sender Filter", t, func(c C) {
+		p := &Plugin{UserCtx: plugin.UserContext{ID: 7002, Name: "digest"}}
+		config := p.DefaultConfig().(*Config)
+		config.ReceiverFilter = rules.RuleChain{{
+			Match:  rules.MatchSet{{Mode: rules.ModeAny}},
+			Action: rules.Digest,
+		}}
+		c.So(p.ValidateAndSetConfig(config), ShouldNotBeNil)
+	})
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/olekukonko/tablewriter"
 )
@@ -28,6 +29,7 @@ For more information, go to [the project page](%s).
 
 // GetDisplay implements public.Displayer
 func (c *Plugin) GetDisplay(baseURL *url.URL) string {
+	c.serverURL.Store(&url.URL{Scheme: baseURL.Scheme, Host: baseURL.Host})
 	baseURL.Path = c.basePath
 	messageURL := &url.URL{
 		Path: "message",
@@ -40,12 +42,23 @@ func (c *Plugin) GetDisplay(baseURL *url.URL) string {
 	docs.WriteString("\r\n\r\nPublic channels on this server:\r\n\r\n")
 	docs.WriteString("```")
 	w := tablewriter.NewWriter(docs)
-	w.SetHeader([]string{"UserID", "UserName", "ChannelName"})
+	w.SetHeader([]string{"UserID", "UserName", "ChannelName", "Description", "Tags", "Subscribers"})
 	for _, channel := range publicChannels.GetAllChannels() {
-		w.Append([]string{strconv.Itoa(int(channel.UserContext.ID)), channel.UserContext.Name, channel.Channel.Name})
+		subscribers := publicChannels.SubscriberCount(channel.UserContext, channel.Channel.Name)
+		w.Append([]string{
+			strconv.Itoa(int(channel.UserContext.ID)),
+			channel.UserContext.Name,
+			channel.Channel.Name,
+			channel.Channel.Description,
+			strings.Join(channel.Channel.Tags, ", "),
+			strconv.Itoa(subscribers),
+		})
 	}
 	w.Render()
 	docs.WriteString("```")
 
+	stats := msgExchanger.Stats(c.UserCtx.ID)
+	fmt.Fprintf(docs, "\r\n\r\nReceived broadcasts: %d delivered, %d dropped, %d timed out.\r\n", stats.Delivered, stats.Dropped, stats.TimedOut)
+
 	return docs.String()
 }
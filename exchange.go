@@ -2,38 +2,284 @@ package main
 
 import (
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/eternal-flame-AD/gotify-broadcast/model"
 )
 
 var msgExchanger = newMessageExchange()
 
+// maxHops is the number of times a broadcast may pass through the exchange before it is dropped.
+const maxHops = 8
+
+const (
+	defaultQueueSize       = 64
+	defaultDeliveryTimeout = 10 * time.Second
+	defaultOverflowPolicy  = OverflowDropOldest
+	// maxHungDeliveries is how many timed out deliveries of a recipient may still be running
+	// before further broadcasts to the recipient are dropped instead of delivered
+	maxHungDeliveries = 4
+)
+
+const (
+	// OverflowDropOldest discards the oldest queued message to make room for the new one.
+	OverflowDropOldest OverflowPolicy = "drop_oldest"
+	// OverflowDropNewest discards the new message.
+	OverflowDropNewest OverflowPolicy = "drop_newest"
+	// OverflowBlock makes the sender wait until there is room in the queue, at most for the delivery timeout.
+	OverflowBlock OverflowPolicy = "block"
+)
+
+// OverflowPolicy describes how a message is handled when the queue of the recipient is full.
+type OverflowPolicy string
+
+// DeliveryStats is the delivery counters of a recipient.
+type DeliveryStats struct {
+	Delivered uint64
+	Dropped   uint64
+	TimedOut  uint64
+}
+
+type subscriber struct {
+	screen func(model.Message) DeliveryStatus
+	cb     func(model.Message)
+
+	mutex  sync.Mutex
+	cond   *sync.Cond
+	queue  []model.Message
+	config DeliveryConfig
+	closed bool
+
+	delivered uint64
+	dropped   uint64
+	timedOut  uint64
+	// hung is the number of timed out deliveries still running
+	hung int32
+}
+
+func newSubscriber(screen func(model.Message) DeliveryStatus, cb func(model.Message)) *subscriber {
+	sub := &subscriber{
+		screen: screen,
+		cb:     cb,
+		config: DeliveryConfig{}.withDefaults(),
+	}
+	sub.cond = sync.NewCond(&sub.mutex)
+	go sub.run()
+	return sub
+}
+
+func (c *subscriber) setConfig(config DeliveryConfig) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.config = config.withDefaults()
+	c.cond.Broadcast()
+}
+
+func (c *subscriber) push(msg model.Message) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	var deadline time.Time
+	for !c.closed && len(c.queue) >= c.config.QueueSize {
+		switch c.config.Overflow {
+		case OverflowDropNewest:
+			atomic.AddUint64(&c.dropped, 1)
+			return false
+		case OverflowDropOldest:
+			c.queue = c.queue[1:]
+			atomic.AddUint64(&c.dropped, 1)
+		default:
+			if deadline.IsZero() {
+				deadline = time.Now().Add(c.config.Timeout)
+				// wake up the wait below once the deadline passes
+				timer := time.AfterFunc(c.config.Timeout, func() {
+					c.mutex.Lock()
+					defer c.mutex.Unlock()
+					c.cond.Broadcast()
+				})
+				defer timer.Stop()
+			} else if !time.Now().Before(deadline) {
+				atomic.AddUint64(&c.dropped, 1)
+				return false
+			}
+			c.cond.Wait()
+		}
+	}
+	if c.closed {
+		return false
+	}
+	c.queue = append(c.queue, msg)
+	c.cond.Broadcast()
+	return true
+}
+
+func (c *subscriber) pop() (model.Message, time.Duration, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for !c.closed && len(c.queue) == 0 {
+		c.cond.Wait()
+	}
+	if c.closed {
+		return model.Message{}, 0, false
+	}
+	msg := c.queue[0]
+	c.queue = c.queue[1:]
+	c.cond.Broadcast()
+	return msg, c.config.Timeout, true
+}
+
+func (c *subscriber) run() {
+	for {
+		msg, timeout, ok := c.pop()
+		if !ok {
+			return
+		}
+		if atomic.LoadInt32(&c.hung) >= maxHungDeliveries {
+			atomic.AddUint64(&c.dropped, 1)
+			continue
+		}
+		// abandoned is set once the delivery timed out, the delivery then counts itself out of hung when it returns
+		var abandoned int32
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			c.cb(msg)
+			if !atomic.CompareAndSwapInt32(&abandoned, 0, 1) {
+				atomic.AddInt32(&c.hung, -1)
+			}
+		}()
+		timer := time.NewTimer(timeout)
+		select {
+		case <-done:
+			timer.Stop()
+			atomic.AddUint64(&c.delivered, 1)
+		case <-timer.C:
+			// a hung delivery must not stall the queue, it is left running and the next delivery starts
+			atomic.AddInt32(&c.hung, 1)
+			if atomic.CompareAndSwapInt32(&abandoned, 0, 1) {
+				atomic.AddUint64(&c.timedOut, 1)
+			} else {
+				// the delivery returned just as the timer fired
+				atomic.AddInt32(&c.hung, -1)
+				atomic.AddUint64(&c.delivered, 1)
+			}
+		}
+	}
+}
+
+func (c *subscriber) close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.closed = true
+	c.queue = nil
+	c.cond.Broadcast()
+}
+
+func (c *subscriber) stats() DeliveryStats {
+	return DeliveryStats{
+		Delivered: atomic.LoadUint64(&c.delivered),
+		Dropped:   atomic.LoadUint64(&c.dropped),
+		TimedOut:  atomic.LoadUint64(&c.timedOut),
+	}
+}
+
 type messageExchange struct {
-	MsgChan   chan<- model.Message
-	callbacks []func(model.Message)
-	mutex     sync.RWMutex
+	subscribers map[uint]*subscriber
+	closed      bool
+	mutex       sync.RWMutex
 }
 
-func (c *messageExchange) OnMessage(cb func(model.Message)) {
-	c.callbacks = append(c.callbacks, cb)
+// OnMessage registers the callback receiving messages addressed to a user.
+// screen is called synchronously on publish to decide whether the message is queued for the callback,
+// a nil screen accepts every message.
+// A previously registered callback for the same user is replaced and its pending messages are discarded.
+func (c *messageExchange) OnMessage(userID uint, screen func(model.Message) DeliveryStatus, cb func(model.Message)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.closed {
+		return
+	}
+	if old, ok := c.subscribers[userID]; ok {
+		old.close()
+	}
+	c.subscribers[userID] = newSubscriber(screen, cb)
 }
 
-func newMessageExchange() *messageExchange {
-	messageExchanger := new(messageExchange)
-	msgChan := make(chan model.Message)
-	messageExchanger.MsgChan = msgChan
-	go func() {
-		for {
-			msg := <-msgChan
-			msg.IsSend = false
-			func() {
-				messageExchanger.mutex.RLock()
-				defer messageExchanger.mutex.RUnlock()
-				for _, cb := range messageExchanger.callbacks {
-					cb(msg)
-				}
-			}()
+// Unsubscribe removes the callback of a user and stops its delivery worker.
+func (c *messageExchange) Unsubscribe(userID uint) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if sub, ok := c.subscribers[userID]; ok {
+		sub.close()
+		delete(c.subscribers, userID)
+	}
+}
+
+// Close stops all delivery workers, messages published afterwards are dropped.
+// Gotify does not tell plugins when the server shuts down, so the plugin itself never closes msgExchanger.
+func (c *messageExchange) Close() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for userID, sub := range c.subscribers {
+		sub.close()
+		delete(c.subscribers, userID)
+	}
+	c.closed = true
+}
+
+// SetDeliveryConfig updates the queue configuration of a user.
+func (c *messageExchange) SetDeliveryConfig(userID uint, config DeliveryConfig) {
+	if sub := c.subscriber(userID); sub != nil {
+		sub.setConfig(config)
+	}
+}
+
+// Stats returns the delivery counters of a user.
+func (c *messageExchange) Stats(userID uint) DeliveryStats {
+	if sub := c.subscriber(userID); sub != nil {
+		return sub.stats()
+	}
+	return DeliveryStats{}
+}
+
+// Publish screens a message with its recipient and queues it for delivery if accepted.
+func (c *messageExchange) Publish(msg model.Message) DeliveryStatus {
+	msg.IsSend = false
+	msg.Hops++
+	if msg.Hops > maxHops {
+		return StatusDropped
+	}
+	sub := c.subscriber(msg.Receiver.ID)
+	if sub == nil {
+		return StatusDropped
+	}
+	if sub.screen != nil {
+		if status := sub.screen(msg); status != StatusDelivered {
+			return status
 		}
-	}()
-	return messageExchanger
+	}
+	if !sub.push(msg) {
+		return StatusDropped
+	}
+	return StatusDelivered
+}
+
+func (c *messageExchange) subscriber(userID uint) *subscriber {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.subscribers[userID]
+}
+
+func newMessageExchange() *messageExchange {
+	return &messageExchange{
+		subscribers: make(map[uint]*subscriber),
+	}
 }
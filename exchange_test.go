@@ -1,6 +1,8 @@
 package main
 
 import (
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -14,21 +16,20 @@ func TestMessageExchange(t *testing.T) {
 	Convey("Test Message Exchange", t, func(c C) {
 		exchanger := newMessageExchange()
 		c.Convey("sends messages", func(c C) {
-			exchanger.MsgChan <- model.Message{}
+			c.So(exchanger.Publish(model.Message{}), ShouldEqual, StatusDropped)
 		})
 		c.Convey("callback receives mesasges", func(c C) {
 			test1Received, test2Received := make(chan struct{}), make(chan struct{})
-			exchanger.OnMessage(func(msg model.Message) {
-				if msg.Sender.ID == 1 {
-					close(test1Received)
-				}
+			exchanger.OnMessage(1, nil, func(msg model.Message) {
+				c.So(msg.Receiver.ID, ShouldEqual, 1)
+				close(test1Received)
 			})
-			exchanger.OnMessage(func(msg model.Message) {
-				if msg.Sender.ID == 1 {
-					close(test2Received)
-				}
+			exchanger.OnMessage(2, nil, func(msg model.Message) {
+				c.So(msg.Receiver.ID, ShouldEqual, 2)
+				close(test2Received)
 			})
-			exchanger.MsgChan <- model.Message{Sender: plugin.UserContext{ID: 1}}
+			c.So(exchanger.Publish(model.Message{Sender: plugin.UserContext{ID: 1}, Receiver: plugin.UserContext{ID: 1}}), ShouldEqual, StatusDelivered)
+			c.So(exchanger.Publish(model.Message{Sender: plugin.UserContext{ID: 1}, Receiver: plugin.UserContext{ID: 2}}), ShouldEqual, StatusDelivered)
 			select {
 			case <-test1Received:
 			case <-time.After(1 * time.Second):
@@ -40,6 +41,282 @@ func TestMessageExchange(t *testing.T) {
 				t.Error("timeout")
 			}
 		})
+		c.Convey("preserves per-sender ordering", func(c C) {
+			received := make(chan int, 100)
+			exchanger.OnMessage(3, nil, func(msg model.Message) {
+				seq, _ := strconv.Atoi(msg.ID)
+				received <- seq
+			})
+			exchanger.SetDeliveryConfig(3, DeliveryConfig{Overflow: OverflowBlock})
+			for i := 0; i < 100; i++ {
+				exchanger.Publish(model.Message{Sender: plugin.UserContext{ID: 1}, Receiver: plugin.UserContext{ID: 3}, ID: strconv.Itoa(i)})
+			}
+			for i := 0; i < 100; i++ {
+				select {
+				case seq := <-received:
+					c.So(seq, ShouldEqual, i)
+				case <-time.After(1 * time.Second):
+					t.Fatal("timeout")
+				}
+			}
+		})
+		c.Convey("screens messages", func(c C) {
+			received := make(chan model.Message, 2)
+			exchanger.OnMessage(7, func(msg model.Message) DeliveryStatus {
+				if msg.ID == "rejected" {
+					return StatusRejectedBySenderFilter
+				}
+				return StatusDelivered
+			}, func(msg model.Message) {
+				received <- msg
+			})
+			c.So(exchanger.Publish(model.Message{Receiver: plugin.UserContext{ID: 7}, ID: "rejected"}), ShouldEqual, StatusRejectedBySenderFilter)
+			c.So(exchanger.Publish(model.Message{Receiver: plugin.UserContext{ID: 7}, ID: "accepted"}), ShouldEqual, StatusDelivered)
+			select {
+			case msg := <-received:
+				c.So(msg.ID, ShouldEqual, "accepted")
+			case <-time.After(1 * time.Second):
+				t.Error("timeout")
+			}
+		})
+		c.Convey("drops messages exceeding hop limit", func(c C) {
+			received := make(chan model.Message, 2)
+			exchanger.OnMessage(2, nil, func(msg model.Message) {
+				received <- msg
+			})
+			c.So(exchanger.Publish(model.Message{Receiver: plugin.UserContext{ID: 2}, Hops: maxHops}), ShouldEqual, StatusDropped)
+			exchanger.Publish(model.Message{Receiver: plugin.UserContext{ID: 2}, ID: "relayed"})
+			select {
+			case msg := <-received:
+				c.So(msg.ID, ShouldEqual, "relayed")
+				c.So(msg.Hops, ShouldEqual, 1)
+			case <-time.After(1 * time.Second):
+				t.Error("timeout")
+			}
+		})
+		c.Convey("slow recipient does not block sender", func(c C) {
+			release := make(chan struct{})
+			defer close(release)
+			exchanger.OnMessage(4, nil, func(msg model.Message) {
+				<-release
+			})
+			exchanger.SetDeliveryConfig(4, DeliveryConfig{QueueSize: 2, Timeout: time.Hour, Overflow: OverflowDropNewest})
+			published := make(chan int)
+			go func() {
+				count := 0
+				for i := 0; i < 10; i++ {
+					if exchanger.Publish(model.Message{Receiver: plugin.UserContext{ID: 4}}) == StatusDelivered {
+						count++
+					}
+				}
+				published <- count
+			}()
+			select {
+			case count := <-published:
+				c.So(count, ShouldBeBetweenOrEqual, 2, 3)
+				c.So(exchanger.Stats(4).Dropped, ShouldEqual, 10-count)
+			case <-time.After(1 * time.Second):
+				t.Error("publish blocked")
+			}
+		})
+		c.Convey("drops oldest on overflow", func(c C) {
+			release := make(chan struct{})
+			received := make(chan string, 10)
+			exchanger.OnMessage(5, nil, func(msg model.Message) {
+				<-release
+				received <- msg.ID
+			})
+			exchanger.SetDeliveryConfig(5, DeliveryConfig{QueueSize: 1, Timeout: time.Hour, Overflow: OverflowDropOldest})
+			exchanger.Publish(model.Message{Receiver: plugin.UserContext{ID: 5}, ID: "first"})
+			time.Sleep(50 * time.Millisecond)
+			exchanger.Publish(model.Message{Receiver: plugin.UserContext{ID: 5}, ID: "second"})
+			exchanger.Publish(model.Message{Receiver: plugin.UserContext{ID: 5}, ID: "third"})
+			close(release)
+			c.So(<-received, ShouldEqual, "first")
+			c.So(<-received, ShouldEqual, "third")
+			c.So(exchanger.Stats(5).Dropped, ShouldEqual, 1)
+		})
+		c.Convey("times out slow deliveries", func(c C) {
+			release := make(chan struct{})
+			defer close(release)
+			exchanger.OnMessage(6, nil, func(msg model.Message) {
+				<-release
+			})
+			exchanger.SetDeliveryConfig(6, DeliveryConfig{Timeout: 10 * time.Millisecond})
+			exchanger.Publish(model.Message{Receiver: plugin.UserContext{ID: 6}})
+			time.Sleep(100 * time.Millisecond)
+			c.So(exchanger.Stats(6).TimedOut, ShouldEqual, 1)
+		})
+		c.Convey("abandons hung deliveries", func(c C) {
+			release := make(chan struct{})
+			defer close(release)
+			received := make(chan string, 3)
+			exchanger.OnMessage(7, nil, func(msg model.Message) {
+				if msg.Msg.Message == "hung" {
+					<-release
+				}
+				received <- msg.Msg.Message
+			})
+			exchanger.SetDeliveryConfig(7, DeliveryConfig{Timeout: 10 * time.Millisecond})
+			exchanger.Publish(model.Message{Receiver: plugin.UserContext{ID: 7}, Msg: plugin.Message{Message: "hung"}})
+			exchanger.Publish(model.Message{Receiver: plugin.UserContext{ID: 7}, Msg: plugin.Message{Message: "next"}})
+			select {
+			case msg := <-received:
+				c.So(msg, ShouldEqual, "next")
+			case <-time.After(time.Second):
+				t.Error("queue stalled by hung delivery")
+			}
+			c.So(exchanger.Stats(7).TimedOut, ShouldEqual, 1)
+		})
+		c.Convey("bounds blocking on hung deliveries", func(c C) {
+			release := make(chan struct{})
+			defer close(release)
+			exchanger.OnMessage(8, nil, func(msg model.Message) {
+				<-release
+			})
+			exchanger.SetDeliveryConfig(8, DeliveryConfig{QueueSize: 1, Timeout: 10 * time.Millisecond, Overflow: OverflowBlock})
+			published := make(chan struct{})
+			go func() {
+				for i := 0; i < 2*maxHungDeliveries+2; i++ {
+					exchanger.Publish(model.Message{Receiver: plugin.UserContext{ID: 8}})
+				}
+				close(published)
+			}()
+			select {
+			case <-published:
+			case <-time.After(5 * time.Second):
+				t.Error("publish blocked")
+			}
+			time.Sleep(50 * time.Millisecond)
+			stats := exchanger.Stats(8)
+			// every broadcast either hangs in delivery or is dropped, by the blocked sender or once too many deliveries hang
+			c.So(stats.TimedOut, ShouldBeBetweenOrEqual, 1, maxHungDeliveries)
+			c.So(stats.TimedOut+stats.Dropped, ShouldEqual, 2*maxHungDeliveries+2)
+		})
+	})
+
+}
+
+func benchmarkExchange(b *testing.B, users int) {
+	exchanger := newMessageExchange()
+	wg := new(sync.WaitGroup)
+	for i := 1; i <= users; i++ {
+		exchanger.OnMessage(uint(i), nil, func(msg model.Message) {
+			wg.Done()
+		})
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		wg.Add(users)
+		for i := 1; i <= users; i++ {
+			exchanger.Publish(model.Message{Sender: plugin.UserContext{ID: 1}, Receiver: plugin.UserContext{ID: uint(i)}})
+		}
+		wg.Wait()
+	}
+}
+
+// benchmarkFanOut mimics the previous exchange design where every callback is invoked for every message
+// and discards messages not addressed to its user.
+func benchmarkFanOut(b *testing.B, users int) {
+	var callbacks []func(model.Message)
+	wg := new(sync.WaitGroup)
+	for i := 1; i <= users; i++ {
+		id := uint(i)
+		callbacks = append(callbacks, func(msg model.Message) {
+			if msg.Receiver.ID != id {
+				return
+			}
+			wg.Done()
+		})
+	}
+	msgChan := make(chan model.Message)
+	go func() {
+		for msg := range msgChan {
+			for _, cb := range callbacks {
+				cb(msg)
+			}
+		}
+	}()
+	defer close(msgChan)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		wg.Add(users)
+		for i := 1; i <= users; i++ {
+			msgChan <- model.Message{Sender: plugin.UserContext{ID: 1}, Receiver: plugin.UserContext{ID: uint(i)}}
+		}
+		wg.Wait()
+	}
+}
+
+func BenchmarkExchange1k(b *testing.B)  { benchmarkExchange(b, 1000) }
+func BenchmarkExchange10k(b *testing.B) { benchmarkExchange(b, 10000) }
+func BenchmarkFanOut1k(b *testing.B)    { benchmarkFanOut(b, 1000) }
+func BenchmarkFanOut10k(b *testing.B)   { benchmarkFanOut(b, 10000) }
+
+func TestExchangeLifecycle(t *testing.T) {
+	Convey("Test Exchange Lifecycle", t, func(c C) {
+		exchanger := newMessageExchange()
+		c.Convey("unsubscribes", func(c C) {
+			exchanger.OnMessage(1, nil, func(msg model.Message) {})
+			c.So(exchanger.Publish(model.Message{Receiver: plugin.UserContext{ID: 1}}), ShouldEqual, StatusDelivered)
+			exchanger.Unsubscribe(1)
+			c.So(exchanger.Publish(model.Message{Receiver: plugin.UserContext{ID: 1}}), ShouldEqual, StatusDropped)
+		})
+		c.Convey("shuts down", func(c C) {
+			exchanger.OnMessage(1, nil, func(msg model.Message) {})
+			exchanger.OnMessage(2, nil, func(msg model.Message) {})
+			exchanger.Close()
+			c.So(exchanger.Publish(model.Message{Receiver: plugin.UserContext{ID: 1}}), ShouldEqual, StatusDropped)
+			exchanger.OnMessage(3, nil, func(msg model.Message) {})
+			c.So(exchanger.Publish(model.Message{Receiver: plugin.UserContext{ID: 3}}), ShouldEqual, StatusDropped)
+		})
 	})
+}
 
+type recordingHandler chan plugin.Message
+
+func (c recordingHandler) SendMessage(msg plugin.Message) error {
+	c <- msg
+	return nil
+}
+
+func TestPluginReinstantiation(t *testing.T) {
+	Convey("Test Re-instantiating Plugin For The Same User", t, func(c C) {
+		userCtx := plugin.UserContext{ID: nextTestUserID(), Name: "reinstantiated"}
+		c.Reset(func() {
+			removeTestUser(userCtx.ID)
+		})
+		newInstance := func() (*Plugin, recordingHandler) {
+			p := NewGotifyPluginInstance(userCtx).(*Plugin)
+			handler := make(recordingHandler, 10)
+			p.SetMessageHandler(handler)
+			c.So(p.ValidateAndSetConfig(p.DefaultConfig()), ShouldBeNil)
+			c.So(p.Enable(), ShouldBeNil)
+			return p, handler
+		}
+		_, oldHandler := newInstance()
+		p, newHandler := newInstance()
+
+		count := 0
+		for _, user := range usersList.GetUsersList() {
+			if user.ID == userCtx.ID {
+				count++
+			}
+		}
+		c.So(count, ShouldEqual, 1)
+
+		msg := p.newBroadcast(plugin.Message{Message: "hello"}, ChannelDef{Name: "example"}, model.OriginAPI)
+		msg.Receiver = userCtx
+		c.So(msgExchanger.Publish(msg), ShouldEqual, StatusDelivered)
+		select {
+		case <-newHandler:
+		case <-time.After(1 * time.Second):
+			t.Error("timeout")
+		}
+		select {
+		case <-oldHandler:
+			t.Error("stale instance received message")
+		case <-time.After(100 * time.Millisecond):
+		}
+	})
 }
@@ -21,6 +21,9 @@ func TestAPICompatibility(t *testing.T) {
 		c.Convey("should have messenger", func(c C) {
 			c.So(new(Plugin), ShouldImplement, (*plugin.Messenger)(nil))
 		})
+		c.Convey("should have storager", func(c C) {
+			c.So(new(Plugin), ShouldImplement, (*plugin.Storager)(nil))
+		})
 		c.Convey("should have displayer", func(c C) {
 			c.So(new(Plugin), ShouldImplement, (*plugin.Displayer)(nil))
 		})
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
+	plugin "github.com/gotify/plugin-api"
+)
+
+var errInvalidInvite = errors.New("invite token is invalid, expired or used up")
+
+// Invite is a token which lets users join a members-only channel
+type Invite struct {
+	Token   string    `json:"token"`
+	Channel string    `json:"channel"`
+	Expires time.Time `json:"expires,omitempty"`
+	MaxUses int       `json:"max_uses,omitempty"`
+	Uses    int       `json:"uses"`
+	Created time.Time `json:"created"`
+}
+
+func (c Invite) usable(now time.Time) bool {
+	if !c.Expires.IsZero() && !now.Before(c.Expires) {
+		return false
+	}
+	return c.MaxUses == 0 || c.Uses < c.MaxUses
+}
+
+// ChannelMembership records a user who joined a channel with an invite
+type ChannelMembership struct {
+	Channel  string    `json:"channel"`
+	UserID   uint      `json:"user_id"`
+	UserName string    `json:"user_name"`
+	Joined   time.Time `json:"joined"`
+}
+
+// createInvite creates an invite to a channel of the user, valid for ttl and maxUses if they are not zero
+func (c *Plugin) createInvite(channel string, ttl time.Duration, maxUses int) (Invite, error) {
+	if _, ok := c.getChannel(channel); !ok {
+		return Invite{}, errChannelNotFound
+	}
+	if ttl < 0 || maxUses < 0 {
+		return Invite{}, errors.New("ttl and max uses must not be negative")
+	}
+	now := time.Now()
+	invite := Invite{
+		Token:   model.NewID(),
+		Channel: channel,
+		MaxUses: maxUses,
+		Created: now,
+	}
+	if ttl > 0 {
+		invite.Expires = now.Add(ttl)
+	}
+	err := c.storage.update(func(data *storedData) {
+		data.Invites = append(data.Invites, invite)
+	})
+	return invite, err
+}
+
+func (c *Plugin) listInvites(channel string) []Invite {
+	res := make([]Invite, 0)
+	c.storage.view(func(data *storedData) {
+		for _, invite := range data.Invites {
+			if channel == "" || invite.Channel == channel {
+				res = append(res, invite)
+			}
+		}
+	})
+	return res
+}
+
+func (c *Plugin) revokeInvite(token string) bool {
+	found := false
+	_ = c.storage.update(func(data *storedData) {
+		res := data.Invites[:0]
+		for _, invite := range data.Invites {
+			if invite.Token == token {
+				found = true
+				continue
+			}
+			res = append(res, invite)
+		}
+		data.Invites = res
+	})
+	return found
+}
+
+// redeemInvite makes user a member of a channel of the owner, redeeming again as a member does not use up the invite
+func (c *Plugin) redeemInvite(channel string, token string, user plugin.UserContext) error {
+	now := time.Now()
+	err := errInvalidInvite
+	_ = c.storage.update(func(data *storedData) {
+		for i, invite := range data.Invites {
+			if invite.Token != token || invite.Channel != channel {
+				continue
+			}
+			for _, member := range data.Joined {
+				if member.Channel == channel && member.UserID == user.ID {
+					err = nil
+					return
+				}
+			}
+			if !invite.usable(now) {
+				return
+			}
+			err = nil
+			data.Invites[i].Uses++
+			data.Joined = append(data.Joined, ChannelMembership{
+				Channel:  channel,
+				UserID:   user.ID,
+				UserName: user.Name,
+				Joined:   now,
+			})
+			return
+		}
+	})
+	return err
+}
+
+// removeMember removes a user who joined a channel with an invite
+func (c *Plugin) removeMember(channel string, userName string) bool {
+	found := false
+	_ = c.storage.update(func(data *storedData) {
+		res := data.Joined[:0]
+		for _, member := range data.Joined {
+			if member.Channel == channel && member.UserName == userName {
+				found = true
+				continue
+			}
+			res = append(res, member)
+		}
+		data.Joined = res
+	})
+	return found
+}
+
+// memberFilter returns whether a user may receive the broadcasts of a channel of the user
+func (c *Plugin) memberFilter(channel ChannelDef) func(user plugin.UserContext) bool {
+	if !channel.MembersOnly {
+		return func(plugin.UserContext) bool { return true }
+	}
+	joined := make(map[uint]struct{})
+	c.storage.view(func(data *storedData) {
+		for _, member := range data.Joined {
+			if member.Channel == channel.Name {
+				joined[member.UserID] = struct{}{}
+			}
+		}
+	})
+	return func(user plugin.UserContext) bool {
+		if _, ok := joined[user.ID]; ok {
+			return true
+		}
+		return user.ID == c.UserCtx.ID || channel.RoleOf(user.Name) != ""
+	}
+}
+
+// joinChannel redeems an invite to a channel given as owner/channel
+func (c *Plugin) joinChannel(ref string, token string) error {
+	i := strings.LastIndex(ref, "/")
+	if i < 0 {
+		return errChannelNotFound
+	}
+	ownerCtx, ok := usersList.GetUserByName(ref[:i])
+	if !ok {
+		return errChannelNotFound
+	}
+	owner := usersList.GetInstance(ownerCtx.ID)
+	if owner == nil {
+		return errChannelNotFound
+	}
+	return owner.redeemInvite(ref[i+1:], token, c.UserCtx)
+}
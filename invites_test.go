@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
+	plugin "github.com/gotify/plugin-api"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestInvites(t *testing.T) {
+	Convey("Test Invites", t, func(c C) {
+		owner, _ := newTestUser(c, "owner", func(config *Config) {
+			config.Channels = []ChannelDef{{Name: "private", MembersOnly: true, ReportRecipients: true}}
+		})
+		guest, _ := newTestUser(c, "guest", nil)
+		newTestUser(c, "stranger", nil)
+		statuses := func() map[string]DeliveryStatus {
+			channel := ChannelDef{Name: "private", MembersOnly: true}
+			report := owner.sendMessage(channel, owner.newBroadcast(plugin.Message{Message: "hello"}, channel, model.OriginAPI))
+			res := make(map[string]DeliveryStatus)
+			for _, recipient := range report.Recipients {
+				res[recipient.UserName] = recipient.Status
+			}
+			return res
+		}
+
+		c.So(statuses()["guest"], ShouldEqual, StatusNotMember)
+		c.So(statuses()["owner"], ShouldEqual, StatusDelivered)
+
+		c.Convey("redeems through the webhook", func(c C) {
+			w := postJSON(newTestWebhook(owner), "/invites?channel=private", `{"ttl": "1h", "max_uses": 1}`, nil)
+			c.So(w.Code, ShouldEqual, http.StatusCreated)
+			invite := new(Invite)
+			c.So(json.Unmarshal(w.Body.Bytes(), invite), ShouldBeNil)
+			c.So(invite.Expires.After(time.Now()), ShouldBeTrue)
+
+			guestHook := newTestWebhook(guest)
+			c.So(postJSON(guestHook, "/join?channel=owner/private&token="+invite.Token, "", nil).Code, ShouldEqual, http.StatusNoContent)
+			c.So(statuses()["guest"], ShouldEqual, StatusDelivered)
+			c.So(statuses()["stranger"], ShouldEqual, StatusNotMember)
+			c.So(postJSON(guestHook, "/join?channel=owner/private&token="+invite.Token, "", nil).Code, ShouldEqual, http.StatusNoContent)
+			c.So(postJSON(guestHook, "/join?channel=owner/private&token=wrong", "", nil).Code, ShouldEqual, http.StatusForbidden)
+			c.So(postJSON(guestHook, "/join?channel=nobody/private&token="+invite.Token, "", nil).Code, ShouldEqual, http.StatusBadRequest)
+
+			c.So(request(newTestWebhook(owner), "DELETE", "/members?channel=private&user=guest").Code, ShouldEqual, http.StatusNoContent)
+			c.So(statuses()["guest"], ShouldEqual, StatusNotMember)
+		})
+		c.Convey("limits uses", func(c C) {
+			invite, err := owner.createInvite("private", 0, 1)
+			c.So(err, ShouldBeNil)
+			c.So(owner.redeemInvite("private", invite.Token, guest.UserCtx), ShouldBeNil)
+			c.So(owner.redeemInvite("private", invite.Token, plugin.UserContext{ID: 13003, Name: "stranger"}), ShouldEqual, errInvalidInvite)
+			c.So(owner.listInvites("private")[0].Uses, ShouldEqual, 1)
+		})
+		c.Convey("expires and revokes", func(c C) {
+			expired := Invite{Token: "t", Expires: time.Now().Add(-time.Second)}
+			c.So(expired.usable(time.Now()), ShouldBeFalse)
+			invite, err := owner.createInvite("private", time.Hour, 0)
+			c.So(err, ShouldBeNil)
+			c.So(owner.revokeInvite(invite.Token), ShouldBeTrue)
+			c.So(owner.revokeInvite(invite.Token), ShouldBeFalse)
+			c.So(owner.redeemInvite("private", invite.Token, guest.UserCtx), ShouldEqual, errInvalidInvite)
+			_, err = owner.createInvite("nonexistent", 0, 0)
+			c.So(err, ShouldNotBeNil)
+		})
+	})
+}
@@ -22,11 +22,14 @@ func main() {
 }
 
 // NewGotifyPluginInstance creates a plugin instance for a user context.
+// An instance previously created for the same user stops receiving broadcasts.
 func NewGotifyPluginInstance(ctx plugin.UserContext) plugin.Plugin {
 	usersList.AddUser(ctx)
-	p := &Plugin{
-		UserCtx: ctx,
+	p := newPlugin(ctx)
+	if old := usersList.SetInstance(p); old != nil {
+		old.teardown()
 	}
-	msgExchanger.OnMessage(p.recvMessage)
+	msgExchanger.OnMessage(ctx.ID, p.screenMessage, p.recvMessage)
+	go p.runScheduler()
 	return p
 }
@@ -1,15 +1,15 @@
 package main
 
 import (
-	"bytes"
 	"text/template"
+	"time"
 
 	"github.com/eternal-flame-AD/gotify-broadcast/model"
 	"github.com/eternal-flame-AD/gotify-broadcast/rules"
 	plugin "github.com/gotify/plugin-api"
 )
 
-var msgTemplate = template.Must(template.New("message").Parse(`
+var msgTemplate = template.Must(template.New("message").Funcs(templateFuncs).Parse(`
 {{.Msg.Message}}
 
 ==============
@@ -17,41 +17,155 @@ var msgTemplate = template.Must(template.New("message").Parse(`
 Sent with gotify-broadcast plugin.
 
 Sender: {{.Sender.Name}}{{if .Sender.Admin}} (Admin){{end}}
-Channel: {{.ChannelName}}
+Channel: {{.Channel.Name}}{{if ne .ChannelOwner.ID .Sender.ID}} (owned by {{.ChannelOwner.Name}}){{end}}
 Priority: {{.Msg.Priority}}
 `))
 
+var markdownMsgTemplate = template.Must(template.New("markdown").Funcs(templateFuncs).Parse(`{{.Msg.Message}}
+
+---
+
+| Sender | Channel | Priority |
+| --- | --- | --- |
+| {{escapeMarkdown .Sender.Name}}{{if .Sender.Admin}} (Admin){{end}} | {{escapeMarkdown .Channel.Name}}{{if ne .ChannelOwner.ID .Sender.ID}} (owned by {{escapeMarkdown .ChannelOwner.Name}}){{end}} | {{.Msg.Priority}} |
+
+*Sent with gotify-broadcast plugin.*
+`))
+
+const markdownContentType = "text/markdown"
+
+// isMarkdown reports whether a message is displayed as markdown by gotify clients
+func isMarkdown(msg plugin.Message) bool {
+	display, ok := msg.Extras["client::display"].(map[string]interface{})
+	return ok && display["contentType"] == markdownContentType
+}
+
+const broadcastMetaKey = "broadcast::meta"
+
+// broadcastMeta describes a broadcast for clients reading the extras of received messages
+func broadcastMeta(msg model.Message) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            msg.ID,
+		"sender_id":     msg.Sender.ID,
+		"sender_name":   msg.Sender.Name,
+		"channel":       msg.Channel.Name,
+		"channel_owner": msg.ChannelOwner.Name,
+		"title":         msg.Msg.Title,
+		"timestamp":     msg.Timestamp.Format(time.RFC3339),
+	}
+}
+
+// withExtra returns a copy of the extras with key set to value, replacing any value the sender set
+func withExtra(extras map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(extras)+1)
+	for k, v := range extras {
+		res[k] = v
+	}
+	res[key] = value
+	return res
+}
+
+// withMarkdown returns a copy of the extras marking the message to be displayed as markdown
+func withMarkdown(extras map[string]interface{}) map[string]interface{} {
+	return mergeExtras(extras, map[string]interface{}{
+		"client::display": map[string]interface{}{"contentType": markdownContentType},
+	})
+}
+
+// screenMessage decides synchronously what happens to a broadcast addressed to the user
+func (c *Plugin) screenMessage(msg model.Message) DeliveryStatus {
+	state := c.loadState()
+	if !state.config.isSubscribed(msg) {
+		return StatusNotSubscribed
+	}
+	action := state.config.SenderFilter.Match(msg, rules.Accept)
+	if action == rules.Reject {
+		return StatusRejectedBySenderFilter
+	}
+	if c.isDuplicate(msg.Msg.Title, msg.Msg.Message, state.config.DuplicateSuppression.Window) {
+		return StatusSuppressedDuplicate
+	}
+	if action == rules.Digest {
+		c.queueDigest(msg)
+		return StatusDigested
+	}
+	if !state.enabled {
+		if state.config.OfflineQueue.Enabled {
+			c.queueOffline(msg)
+			return StatusQueuedOffline
+		}
+		return StatusRecipientDisabled
+	}
+	if state.config.QuietHours.holds(msg, time.Now()) {
+		c.holdMessage(msg)
+		return StatusHeld
+	}
+	coalesce := state.config.Coalesce
+	if c.repeats.observe(coalesce, msg, c.sendRepeatSummary(coalesce.Window)) {
+		return StatusCoalesced
+	}
+	return StatusDelivered
+}
+
+// recvMessage delivers a broadcast accepted by screenMessage
 func (c *Plugin) recvMessage(msg model.Message) {
-	if !c.enabled {
+	state := c.loadState()
+	if !state.enabled {
+		if state.config.OfflineQueue.Enabled {
+			c.queueOffline(msg)
+		}
 		return
 	}
-	if msg.Receiver.ID != c.UserCtx.ID {
+	c.deliver(state, msg)
+}
+
+// isStale reports whether a broadcast has expired or is older than the max age accepted by the user
+func isStale(config *Config, msg model.Message, now time.Time) bool {
+	if msg.Expired(now) {
+		return true
+	}
+	return config.MaxAge > 0 && now.Sub(msg.Timestamp) > config.MaxAge
+}
+
+func (c *Plugin) deliver(state *pluginState, msg model.Message) {
+	if state.msgHandler == nil || isStale(state.config, msg, time.Now()) {
 		return
 	}
-	if action := c.config.SenderFilter.Match(msg, rules.Accept); action == rules.Accept {
-		wrappedMsg := bytes.NewBuffer([]byte{})
-		if err := msgTemplate.Execute(wrappedMsg, msg); err == nil {
-			msg.Msg.Message = wrappedMsg.String()
-		}
-		_ = c.msgHandler.SendMessage(msg.Msg)
+	_ = state.msgHandler.SendMessage(render(state.config, msg))
+}
+
+func (c *Plugin) newBroadcast(msg plugin.Message, channel ChannelDef, origin model.Origin) model.Message {
+	return model.Message{
+		Sender:       c.UserCtx,
+		Msg:          msg,
+		Channel:      channel.Info(),
+		ChannelOwner: c.UserCtx,
+		ID:           model.NewID(),
+		Timestamp:    time.Now(),
+		Origin:       origin,
 	}
 }
 
-func (c *Plugin) sendMessage(msg plugin.Message, chanName string) int {
-	sent := 0
+func (c *Plugin) sendMessage(channel ChannelDef, broadcast model.Message) *DeliveryReport {
+	config := c.loadState().config
+	report := newDeliveryReport(broadcast.ID)
+	isMember := c.memberFilter(channel)
 	for _, recipient := range usersList.GetUsersList() {
-		msgWrapped := model.Message{
-			Sender:      c.UserCtx,
-			Receiver:    recipient,
-			Msg:         msg,
-			ChannelName: chanName,
-
-			IsSend: true,
-		}
-		if action := c.config.ReceiverFilter.Match(msgWrapped, rules.Accept); action == rules.Accept {
-			msgExchanger.MsgChan <- msgWrapped
-			sent++
+		msgWrapped := broadcast
+		msgWrapped.Receiver = recipient
+		msgWrapped.ReceiverRole = channel.RoleOf(recipient.Name)
+		msgWrapped.IsSend = true
+		status := StatusRejectedByReceiverFilter
+		if !isMember(recipient) {
+			status = StatusNotMember
+		} else if action := config.ReceiverFilter.Match(msgWrapped, rules.Accept); action == rules.Accept {
+			status = msgExchanger.Publish(msgWrapped)
 		}
+		report.add(RecipientReport{
+			UserID:   recipient.ID,
+			UserName: recipient.Name,
+			Status:   status,
+		})
 	}
-	return sent
+	return report
 }
@@ -0,0 +1,105 @@
+package model
+
+import "time"
+
+// ChannelInfo is the public part of a channel definition, which is all a broadcast carries of its channel
+type ChannelInfo struct {
+	Name        string
+	Public      bool
+	Description string
+	Tags        []string
+}
+
+// ChannelDef is the definition of a channel in the configuration
+type ChannelDef struct {
+	Name   string `yaml:"name"`
+	Public bool   `yaml:"public"`
+
+	Description string   `yaml:"description,omitempty"`
+	Tags        []string `yaml:"tags,omitempty"`
+	// DefaultPriority is the priority of broadcasts which do not specify one.
+	DefaultPriority *int `yaml:"default_priority,omitempty"`
+	// TitlePrefix is prepended to the title of every broadcast.
+	TitlePrefix string `yaml:"title_prefix,omitempty"`
+	// DefaultExtras are merged into the extras of every broadcast, extras of the broadcast take precedence.
+	DefaultExtras map[string]interface{} `yaml:"default_extras,omitempty"`
+	// TitleTemplate and BodyTemplate are Go text/templates executed with the broadcast to render its title and body.
+	TitleTemplate string `yaml:"title_template,omitempty"`
+	BodyTemplate  string `yaml:"body_template,omitempty"`
+
+	// ReportRecipients includes the name and delivery status of every recipient in the webhook response.
+	ReportRecipients bool `yaml:"report_recipients,omitempty"`
+	// DedupWindow is how long an idempotency key is remembered, defaults to 10 minutes.
+	DedupWindow time.Duration `yaml:"dedup_window,omitempty"`
+	// Quota limits how often broadcasts can be sent through the channel and how many users they reach.
+	Quota Quota `yaml:"quota,omitempty"`
+	// MembersOnly delivers broadcasts only to the owner, members and users who joined with an invite.
+	MembersOnly bool `yaml:"members_only,omitempty"`
+	// Moderated holds broadcasts posted by other users until the owner approves them.
+	Moderated bool `yaml:"moderated,omitempty"`
+	// ModerationTimeout is how long a broadcast waits for approval, defaults to 24 hours.
+	ModerationTimeout time.Duration `yaml:"moderation_timeout,omitempty"`
+	// Members are other users given a role in the channel by its owner.
+	Members []ChannelMember `yaml:"members,omitempty"`
+}
+
+const (
+	// RolePoster may post to the channel and receives its broadcasts.
+	RolePoster ChannelRole = "poster"
+	// RoleSubscriber receives the broadcasts of the channel.
+	RoleSubscriber ChannelRole = "subscriber"
+)
+
+// ChannelRole is the role of a member of a channel
+type ChannelRole string
+
+// ChannelMember gives a user a role in a channel
+type ChannelMember struct {
+	User string      `yaml:"user"`
+	Role ChannelRole `yaml:"role"`
+}
+
+// Info returns the public part of the channel definition
+func (c ChannelDef) Info() ChannelInfo {
+	return ChannelInfo{
+		Name:        c.Name,
+		Public:      c.Public,
+		Description: c.Description,
+		Tags:        c.Tags,
+	}
+}
+
+// RoleOf returns the role of a user in the channel, or an empty role if the user is not a member
+func (c ChannelDef) RoleOf(user string) ChannelRole {
+	for _, member := range c.Members {
+		if member.User == user {
+			return member.Role
+		}
+	}
+	return ""
+}
+
+// Quota limits broadcasts sent through a channel, zero values are unlimited
+type Quota struct {
+	PerMinute     int `yaml:"per_minute,omitempty"`
+	PerHour       int `yaml:"per_hour,omitempty"`
+	PerDay        int `yaml:"per_day,omitempty"`
+	MaxRecipients int `yaml:"max_recipients,omitempty"`
+}
+
+// Within returns the stricter of both quotas for every limit
+func (q Quota) Within(ceiling Quota) Quota {
+	return Quota{
+		PerMinute:     stricterLimit(q.PerMinute, ceiling.PerMinute),
+		PerHour:       stricterLimit(q.PerHour, ceiling.PerHour),
+		PerDay:        stricterLimit(q.PerDay, ceiling.PerDay),
+		MaxRecipients: stricterLimit(q.MaxRecipients, ceiling.MaxRecipients),
+	}
+}
+
+func stricterLimit(a, b int) int {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,26 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestQuotaWithin(t *testing.T) {
+	Convey("Test Quota Ceiling", t, func(c C) {
+		q := Quota{PerMinute: 10, PerDay: 100}
+		c.So(q.Within(Quota{}), ShouldResemble, q)
+		c.So(Quota{}.Within(q), ShouldResemble, q)
+		c.So(q.Within(Quota{PerMinute: 5, PerHour: 50, PerDay: 500, MaxRecipients: 3}), ShouldResemble,
+			Quota{PerMinute: 5, PerHour: 50, PerDay: 100, MaxRecipients: 3})
+	})
+}
+
+func TestRoleOf(t *testing.T) {
+	Convey("Test Channel Roles", t, func(c C) {
+		channel := ChannelDef{Members: []ChannelMember{{User: "bob", Role: RolePoster}, {User: "carol", Role: RoleSubscriber}}}
+		c.So(channel.RoleOf("bob"), ShouldEqual, RolePoster)
+		c.So(channel.RoleOf("carol"), ShouldEqual, RoleSubscriber)
+		c.So(channel.RoleOf("dave"), ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// WildcardToken matches exactly one token of a channel name.
+	WildcardToken = "*"
+	// WildcardTail matches one or more trailing tokens of a channel name.
+	WildcardTail = ">"
+)
+
+func validToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	for _, r := range token {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// CheckChannelName checks that a channel name consists of dot separated tokens of letters, digits, '_' and '-'
+func CheckChannelName(name string) error {
+	for _, token := range strings.Split(name, ".") {
+		if !validToken(token) {
+			return fmt.Errorf("invalid channel name %q: tokens must be non-empty and contain only letters, digits, '_' and '-'", name)
+		}
+	}
+	return nil
+}
+
+// CheckChannelPattern checks a channel name which may contain the wildcards '*' and '>', the latter only as the last token
+func CheckChannelPattern(pattern string) error {
+	tokens := strings.Split(pattern, ".")
+	for i, token := range tokens {
+		if token == WildcardToken || (token == WildcardTail && i == len(tokens)-1) {
+			continue
+		}
+		if !validToken(token) {
+			return fmt.Errorf("invalid channel pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// MatchChannelName reports whether a channel name matches a pattern checked by CheckChannelPattern
+func MatchChannelName(pattern string, name string) bool {
+	patternTokens := strings.Split(pattern, ".")
+	nameTokens := strings.Split(name, ".")
+	for i, token := range patternTokens {
+		if token == WildcardTail && i == len(patternTokens)-1 {
+			return len(nameTokens) > i
+		}
+		if i >= len(nameTokens) || (token != WildcardToken && token != nameTokens[i]) {
+			return false
+		}
+	}
+	return len(nameTokens) == len(patternTokens)
+}
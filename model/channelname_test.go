@@ -0,0 +1,37 @@
+package model
+
+import (
+	"testing"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestChannelNames(t *testing.T) {
+	Convey("Test Channel Names", t, func(c C) {
+		c.Convey("grammar", func(c C) {
+			for _, name := range []string{"ops", "ops.db.primary", "team-a.build_42"} {
+				c.So(CheckChannelName(name), ShouldBeNil)
+			}
+			for _, name := range []string{"", "ops.", ".ops", "ops..db", "ops db", "ops.*", "ops/db"} {
+				c.So(CheckChannelName(name), ShouldNotBeNil)
+			}
+			for _, pattern := range []string{"ops.*", "ops.>", "*.db.*", ">"} {
+				c.So(CheckChannelPattern(pattern), ShouldBeNil)
+			}
+			for _, pattern := range []string{"ops.>.db", "ops.d*", "ops."} {
+				c.So(CheckChannelPattern(pattern), ShouldNotBeNil)
+			}
+		})
+		c.Convey("matching", func(c C) {
+			c.So(MatchChannelName("ops.db", "ops.db"), ShouldBeTrue)
+			c.So(MatchChannelName("ops.db", "ops.db.primary"), ShouldBeFalse)
+			c.So(MatchChannelName("ops.*", "ops.db"), ShouldBeTrue)
+			c.So(MatchChannelName("ops.*", "ops.db.primary"), ShouldBeFalse)
+			c.So(MatchChannelName("ops.*", "ops"), ShouldBeFalse)
+			c.So(MatchChannelName("ops.>", "ops.db.primary"), ShouldBeTrue)
+			c.So(MatchChannelName("ops.>", "ops"), ShouldBeFalse)
+			c.So(MatchChannelName("*.db.*", "ops.db.primary"), ShouldBeTrue)
+			c.So(MatchChannelName(">", "anything.at.all"), ShouldBeTrue)
+		})
+	})
+}
@@ -1,15 +1,69 @@
 package model
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
 	"github.com/gotify/plugin-api"
 )
 
+const (
+	// OriginWebhook is a broadcast posted to the message webhook.
+	OriginWebhook Origin = "webhook"
+	// OriginScheduler is a broadcast fired by the scheduler.
+	OriginScheduler Origin = "scheduler"
+	// OriginRelay is a broadcast relayed from another broadcast.
+	OriginRelay Origin = "relay"
+	// OriginAPI is a broadcast created programmatically.
+	OriginAPI Origin = "api"
+)
+
+// Origin describes where a broadcast is created.
+type Origin string
+
 // Message is a message wrapper with the channel, sender and recipient.
 type Message struct {
-	Sender      plugin.UserContext
-	Receiver    plugin.UserContext
-	Msg         plugin.Message
-	ChannelName string
+	Sender   plugin.UserContext
+	Receiver plugin.UserContext
+	Msg      plugin.Message
+
+	// Channel is the public part of the definition of the channel the message is sent through.
+	Channel ChannelInfo
+	// ChannelOwner is the user possessing the channel.
+	ChannelOwner plugin.UserContext
+	// ReceiverRole is the role of the receiver in the channel, empty if the receiver is not a member.
+	ReceiverRole ChannelRole
+
+	// ID identifies the broadcast and is shared by all copies of it.
+	ID string
+	// Timestamp is the time the broadcast is created.
+	Timestamp time.Time
+	// ExpiresAt is the time after which the broadcast must not be delivered, zero if it never expires.
+	ExpiresAt time.Time
+	// Origin is where the broadcast is created.
+	Origin Origin
+	// SourceIP is the client IP of the webhook request which created the broadcast.
+	// It honours X-Forwarded-For from the proxies trusted by the gotify server.
+	SourceIP string
+	// UserAgent is the User-Agent of the webhook request which created the broadcast.
+	UserAgent string
+	// Hops is the number of times the broadcast has passed through the exchange.
+	Hops int
 
 	IsSend bool
 }
+
+// Expired reports whether the broadcast has passed its expiry time.
+func (c Message) Expired(now time.Time) bool {
+	return !c.ExpiresAt.IsZero() && now.After(c.ExpiresAt)
+}
+
+// NewID generates a random broadcast ID.
+func NewID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,25 @@
+package model
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestNewID(t *testing.T) {
+	Convey("Test Broadcast ID Generation", t, func(c C) {
+		id := NewID()
+		c.So(id, ShouldHaveLength, 32)
+		c.So(NewID(), ShouldNotEqual, id)
+	})
+}
+
+func TestExpired(t *testing.T) {
+	Convey("Test Message Expiry", t, func(c C) {
+		now := time.Now()
+		c.So(Message{}.Expired(now), ShouldBeFalse)
+		c.So(Message{ExpiresAt: now.Add(time.Minute)}.Expired(now), ShouldBeFalse)
+		c.So(Message{ExpiresAt: now.Add(-time.Minute)}.Expired(now), ShouldBeTrue)
+	})
+}
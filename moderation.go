@@ -0,0 +1,164 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
+	plugin "github.com/gotify/plugin-api"
+)
+
+const (
+	defaultModerationTimeout = 24 * time.Hour
+	// maxPendingPerChannel is how many proposals to a channel may wait for approval at once
+	maxPendingPerChannel = 20
+	// maxPendingPerProposer is how many proposals of a user to a channel may wait for approval at once
+	maxPendingPerProposer = 3
+)
+
+var (
+	errPendingNotFound = errors.New("pending broadcast not found or expired")
+	errTooManyPending  = errors.New("too many proposals are waiting for approval")
+)
+
+// PendingBroadcast is a broadcast posted to a moderated channel waiting for approval by its owner
+type PendingBroadcast struct {
+	ID        string        `json:"id"`
+	Token     string        `json:"token"`
+	Broadcast model.Message `json:"broadcast"`
+	Expires   time.Time     `json:"expires"`
+}
+
+func moderationTimeout(channel ChannelDef) time.Duration {
+	if channel.ModerationTimeout > 0 {
+		return channel.ModerationTimeout
+	}
+	return defaultModerationTimeout
+}
+
+// moderationBaseURL returns the URL the moderation links are resolved against: the webhook of the user on the server
+// the user last opened the plugin display on, or a path on the same server if it was not opened yet.
+// The request of a proposing user is never used, since the links carry the secret webhook path of the user.
+func (c *Plugin) moderationBaseURL() *url.URL {
+	if server, ok := c.serverURL.Load().(*url.URL); ok {
+		return &url.URL{Scheme: server.Scheme, Host: server.Host, Path: c.basePath}
+	}
+	return &url.URL{Path: c.basePath}
+}
+
+// submitForApproval queues a broadcast to a moderated channel of the user and notifies the user with approve and reject links
+func (c *Plugin) submitForApproval(channel ChannelDef, broadcast model.Message) (PendingBroadcast, error) {
+	now := time.Now()
+	pending := PendingBroadcast{
+		ID:        broadcast.ID,
+		Token:     model.NewID(),
+		Broadcast: broadcast,
+		Expires:   now.Add(moderationTimeout(channel)),
+	}
+	var full bool
+	err := c.storage.update(func(data *storedData) {
+		data.Pending = pruneExpiredPending(data.Pending, now)
+		inChannel, byProposer := 0, 0
+		for _, p := range data.Pending {
+			if p.Broadcast.Channel.Name == broadcast.Channel.Name {
+				inChannel++
+				if p.Broadcast.Sender.ID == broadcast.Sender.ID {
+					byProposer++
+				}
+			}
+		}
+		if full = inChannel >= maxPendingPerChannel || byProposer >= maxPendingPerProposer; !full {
+			data.Pending = append(data.Pending, pending)
+		}
+	})
+	if err != nil {
+		return pending, err
+	}
+	if full {
+		return pending, errTooManyPending
+	}
+
+	if state := c.loadState(); state.enabled && state.msgHandler != nil {
+		baseURL := c.moderationBaseURL()
+		link := func(action string) string {
+			u := baseURL.ResolveReference(&url.URL{Path: "moderation/" + pending.ID + "/" + action})
+			u.RawQuery = url.Values{"token": {pending.Token}}.Encode()
+			return u.String()
+		}
+		_ = state.msgHandler.SendMessage(plugin.Message{
+			Title: fmt.Sprintf("%s proposes a broadcast to %s", broadcast.Sender.Name, broadcast.Channel.Name),
+			Message: fmt.Sprintf("**%s**\n\n%s\n\n[Approve](%s) | [Reject](%s)\n\nExpires at %s.",
+				// the proposal is escaped so that it cannot pass off links of its own as the moderation links
+				markdownEscaper.Replace(broadcast.Msg.Title), markdownEscaper.Replace(broadcast.Msg.Message),
+				link("approve"), link("reject"), pending.Expires.Format(time.RFC1123)),
+			Priority: broadcast.Msg.Priority,
+			Extras: map[string]interface{}{
+				"client::display": map[string]interface{}{"contentType": "text/markdown"},
+			},
+		})
+	}
+	return pending, nil
+}
+
+func pruneExpiredPending(pending []PendingBroadcast, now time.Time) []PendingBroadcast {
+	res := pending[:0]
+	for _, p := range pending {
+		if now.Before(p.Expires) {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+func (c *Plugin) listPending() []PendingBroadcast {
+	res := make([]PendingBroadcast, 0)
+	now := time.Now()
+	c.storage.view(func(data *storedData) {
+		for _, p := range data.Pending {
+			if now.Before(p.Expires) {
+				res = append(res, p)
+			}
+		}
+	})
+	return res
+}
+
+// takePending removes a pending broadcast if the token matches and it has not expired
+func (c *Plugin) takePending(id string, token string) (PendingBroadcast, error) {
+	var res PendingBroadcast
+	err := errPendingNotFound
+	now := time.Now()
+	_ = c.storage.update(func(data *storedData) {
+		data.Pending = pruneExpiredPending(data.Pending, now)
+		for i, p := range data.Pending {
+			if p.ID == id && p.Token == token {
+				res, err = p, nil
+				data.Pending = append(data.Pending[:i], data.Pending[i+1:]...)
+				return
+			}
+		}
+	})
+	return res, err
+}
+
+// moderate approves or rejects a pending broadcast, approved broadcasts are sent immediately if the channel quota permits it
+func (c *Plugin) moderate(id string, token string, approve bool) (*DeliveryReport, error) {
+	pending, err := c.takePending(id, token)
+	if err != nil || !approve {
+		return nil, err
+	}
+	channel, ok := c.getChannel(pending.Broadcast.Channel.Name)
+	if !ok {
+		return nil, errChannelNotFound
+	}
+	if err := c.enforceQuota(channel, pending.Broadcast, true); err != nil {
+		// keep the proposal so that it can be approved once the quota permits it
+		_ = c.storage.update(func(data *storedData) {
+			data.Pending = append(data.Pending, pending)
+		})
+		return nil, err
+	}
+	return c.sendMessage(channel, pending.Broadcast), nil
+}
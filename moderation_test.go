@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestModeratedChannels(t *testing.T) {
+	Convey("Test Moderated Channels", t, func(c C) {
+		owner, ownerHandler := newTestUser(c, "owner", func(config *Config) {
+			config.Channels = []ChannelDef{{Name: "announcements", Moderated: true, ModerationTimeout: time.Hour}}
+		})
+		team, teamHandler := newTestUser(c, "team", nil)
+		ownerHook := newTestWebhook(owner)
+
+		w := postJSON(newTestWebhook(team), "/message?channel=owner/announcements", `{"title": "Release", "message": "v2 is out"}`, nil)
+		c.So(w.Code, ShouldEqual, http.StatusAccepted)
+		notification := <-ownerHandler
+		c.So(notification.Title, ShouldEqual, "team proposes a broadcast to announcements")
+		c.So(notification.Message, ShouldContainSubstring, "](/plugin/1/custom/token/moderation/")
+		pending := owner.listPending()
+		c.So(pending, ShouldHaveLength, 1)
+		c.So(teamHandler, ShouldBeEmpty)
+
+		c.Convey("approve", func(c C) {
+			path := "/moderation/" + pending[0].ID + "/approve?token=" + pending[0].Token
+			c.So(request(ownerHook, "GET", "/moderation/"+pending[0].ID+"/approve?token=wrong").Code, ShouldEqual, http.StatusNotFound)
+			c.So(request(ownerHook, "GET", path).Code, ShouldEqual, http.StatusOK)
+			select {
+			case msg := <-teamHandler:
+				c.So(msg.Title, ShouldEqual, "Release")
+			case <-time.After(time.Second):
+				c.So("approved broadcast not delivered", ShouldBeEmpty)
+			}
+			c.So(request(ownerHook, "GET", path).Code, ShouldEqual, http.StatusNotFound)
+		})
+		c.Convey("approve within the quota", func(c C) {
+			config := owner.DefaultConfig().(*Config)
+			config.Channels = []ChannelDef{{Name: "announcements", Moderated: true, Quota: Quota{PerMinute: 1}}}
+			c.So(owner.ValidateAndSetConfig(config), ShouldBeNil)
+			c.So(postJSON(newTestWebhook(team), "/message?channel=owner/announcements", `{"title": "Second"}`, nil).Code, ShouldEqual, http.StatusAccepted)
+			<-ownerHandler
+			pending := owner.listPending()
+			c.So(pending, ShouldHaveLength, 2)
+			for i, code := range []int{http.StatusOK, http.StatusTooManyRequests} {
+				c.So(request(ownerHook, "GET", "/moderation/"+pending[i].ID+"/approve?token="+pending[i].Token).Code, ShouldEqual, code)
+			}
+			c.So(owner.listPending(), ShouldHaveLength, 1)
+		})
+		c.Convey("escapes the proposal in the notification", func(c C) {
+			body := `{"title": "**urgent**", "message": "[Approve](https://attacker.example.com)"}`
+			c.So(postJSON(newTestWebhook(team), "/message?channel=owner/announcements", body, nil).Code, ShouldEqual, http.StatusAccepted)
+			notification := <-ownerHandler
+			c.So(notification.Message, ShouldStartWith, `**\*\*urgent\*\***`)
+			c.So(notification.Message, ShouldContainSubstring, `\[Approve\]\(https://attacker\.example\.com\)`)
+			c.So(strings.Count(notification.Message, "[Approve]("), ShouldEqual, 1)
+		})
+		c.Convey("limits pending proposals", func(c C) {
+			teamHook := newTestWebhook(team)
+			for i, code := range []int{http.StatusAccepted, http.StatusAccepted, http.StatusTooManyRequests} {
+				c.So(postJSON(teamHook, "/message?channel=owner/announcements", `{"message": "again"}`, nil).Code, ShouldEqual, code)
+				if i < 2 {
+					<-ownerHandler
+				}
+			}
+			c.So(ownerHandler, ShouldBeEmpty)
+			other, _ := newTestUser(c, "other", nil)
+			c.So(postJSON(newTestWebhook(other), "/message?channel=owner/announcements", `{"message": "mine"}`, nil).Code, ShouldEqual, http.StatusAccepted)
+			c.So(owner.listPending(), ShouldHaveLength, maxPendingPerProposer+1)
+		})
+		c.Convey("members only", func(c C) {
+			config := owner.DefaultConfig().(*Config)
+			config.Channels = []ChannelDef{{Name: "announcements", Moderated: true, MembersOnly: true, Members: []model.ChannelMember{
+				{User: "team", Role: model.RoleSubscriber},
+			}}}
+			c.So(owner.ValidateAndSetConfig(config), ShouldBeNil)
+			stranger, _ := newTestUser(c, "stranger", nil)
+			c.So(postJSON(newTestWebhook(stranger), "/message?channel=owner/announcements", `{"message": "hi"}`, nil).Code, ShouldEqual, http.StatusForbidden)
+			c.So(postJSON(newTestWebhook(team), "/message?channel=owner/announcements", `{"message": "hi"}`, nil).Code, ShouldEqual, http.StatusAccepted)
+		})
+		c.Convey("reject", func(c C) {
+			c.So(request(ownerHook, "GET", "/moderation/"+pending[0].ID+"/reject?token="+pending[0].Token).Code, ShouldEqual, http.StatusOK)
+			c.So(owner.listPending(), ShouldBeEmpty)
+			time.Sleep(50 * time.Millisecond)
+			c.So(teamHandler, ShouldBeEmpty)
+		})
+		c.Convey("expire", func(c C) {
+			c.So(pruneExpiredPending(pending, time.Now().Add(2*time.Hour)), ShouldBeEmpty)
+		})
+		c.Convey("links to the server of the plugin display", func(c C) {
+			owner.GetDisplay(&url.URL{Scheme: "https", Host: "gotify.example.com"})
+			req := httptest.NewRequest("POST", "/message?channel=owner/announcements", strings.NewReader(`{"message": "hi"}`))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Forwarded-Proto", "http")
+			req.Host = "attacker.example.com"
+			newTestWebhook(team).ServeHTTP(httptest.NewRecorder(), req)
+			notification := <-ownerHandler
+			c.So(notification.Message, ShouldContainSubstring, "](https://gotify.example.com/plugin/1/custom/token/moderation/")
+			c.So(notification.Message, ShouldNotContainSubstring, "attacker.example.com")
+		})
+		c.Convey("owner posts directly", func(c C) {
+			c.So(postJSON(ownerHook, "/message?channel=announcements", `{"message": "hi"}`, nil).Code, ShouldEqual, http.StatusOK)
+		})
+	})
+}
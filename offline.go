@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
+	"github.com/gotify/plugin-api"
+)
+
+const (
+	defaultOfflineQueueMaxMessages = 100
+	defaultOfflineQueueMaxAge      = 24 * time.Hour
+)
+
+// OfflineQueueConfig configures queueing of broadcasts received while the plugin is disabled
+type OfflineQueueConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	MaxMessages int           `yaml:"max_messages,omitempty"`
+	MaxAge      time.Duration `yaml:"max_age,omitempty"`
+	Digest      bool          `yaml:"digest,omitempty"`
+}
+
+func (c OfflineQueueConfig) withDefaults() OfflineQueueConfig {
+	if c.MaxMessages == 0 {
+		c.MaxMessages = defaultOfflineQueueMaxMessages
+	}
+	if c.MaxAge == 0 {
+		c.MaxAge = defaultOfflineQueueMaxAge
+	}
+	return c
+}
+
+// Check checks an OfflineQueueConfig for errors
+func (c OfflineQueueConfig) Check() error {
+	if c.MaxMessages < 0 {
+		return errors.New("offline queue max messages must not be negative")
+	}
+	if c.MaxAge < 0 {
+		return errors.New("offline queue max age must not be negative")
+	}
+	return nil
+}
+
+// trimOfflineQueue drops messages older than the max age and the oldest messages exceeding the max count
+func trimOfflineQueue(queue []model.Message, config OfflineQueueConfig, now time.Time) []model.Message {
+	config = config.withDefaults()
+	res := make([]model.Message, 0, len(queue))
+	for _, msg := range queue {
+		if now.Sub(msg.Timestamp) <= config.MaxAge && !msg.Expired(now) {
+			res = append(res, msg)
+		}
+	}
+	if len(res) > config.MaxMessages {
+		res = res[len(res)-config.MaxMessages:]
+	}
+	return res
+}
+
+func (c *Plugin) queueOffline(msg model.Message) {
+	config := c.loadState().config.OfflineQueue
+	_ = c.storage.update(func(data *storedData) {
+		data.OfflineQueue = trimOfflineQueue(append(data.OfflineQueue, msg), config, time.Now())
+	})
+	// the plugin might have been enabled while the message is queued
+	if c.loadState().enabled {
+		c.flushOfflineQueue()
+	}
+}
+
+// flushOfflineQueue delivers broadcasts queued while the plugin was disabled
+func (c *Plugin) flushOfflineQueue() {
+	state := c.loadState()
+	if !state.enabled || state.msgHandler == nil {
+		return
+	}
+	var queue []model.Message
+	_ = c.storage.update(func(data *storedData) {
+		queue = trimOfflineQueue(data.OfflineQueue, state.config.OfflineQueue, time.Now())
+		data.OfflineQueue = nil
+	})
+	now := time.Now()
+	fresh := queue[:0]
+	for _, msg := range queue {
+		if !isStale(state.config, msg, now) {
+			fresh = append(fresh, msg)
+		}
+	}
+	queue = fresh
+	if len(queue) == 0 {
+		return
+	}
+	if state.config.OfflineQueue.Digest {
+		_ = state.msgHandler.SendMessage(renderOfflineDigest(queue))
+		return
+	}
+	for _, msg := range queue {
+		c.deliver(state, msg)
+	}
+}
+
+func renderOfflineDigest(queue []model.Message) plugin.Message {
+	body := bytes.NewBuffer([]byte{})
+	priority := 0
+	for _, msg := range queue {
+		fmt.Fprintf(body, "[%s] %s: %s\n%s\n\n", msg.Channel.Name, msg.Sender.Name, msg.Msg.Title, msg.Msg.Message)
+		if msg.Msg.Priority > priority {
+			priority = msg.Msg.Priority
+		}
+	}
+	return plugin.Message{
+		Title:    fmt.Sprintf("%d broadcasts received while disabled", len(queue)),
+		Message:  body.String(),
+		Priority: priority,
+	}
+}
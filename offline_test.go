@@ -0,0 +1,137 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
+	plugin "github.com/gotify/plugin-api"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+type memoryStorage struct {
+	data []byte
+}
+
+func (c *memoryStorage) Save(b []byte) error {
+	c.data = b
+	return nil
+}
+
+func (c *memoryStorage) Load() ([]byte, error) {
+	return c.data, nil
+}
+
+func TestOfflineQueue(t *testing.T) {
+	Convey("Test Offline Queue", t, func(c C) {
+		store := new(memoryStorage)
+		newPlugin := func(digest bool) (*Plugin, recordingHandler) {
+			p := &Plugin{
+				UserCtx: plugin.UserContext{ID: 3001, Name: "offline"},
+			}
+			handler := make(recordingHandler, 10)
+			p.SetStorageHandler(store)
+			p.SetMessageHandler(handler)
+			config := p.DefaultConfig().(*Config)
+			config.OfflineQueue.Enabled = true
+			config.OfflineQueue.Digest = digest
+			c.So(p.ValidateAndSetConfig(config), ShouldBeNil)
+			return p, handler
+		}
+		broadcast := func(title string) model.Message {
+			return model.Message{
+				Sender:    plugin.UserContext{ID: 1, Name: "sender"},
+				Channel:   ChannelInfo{Name: "test_channel"},
+				Msg:       plugin.Message{Title: title, Message: "text", Priority: 3},
+				Timestamp: time.Now(),
+			}
+		}
+
+		c.Convey("delivers queued broadcasts after restart", func(c C) {
+			p, handler := newPlugin(false)
+			p.recvMessage(broadcast("first"))
+			p.recvMessage(broadcast("second"))
+			c.So(handler, ShouldBeEmpty)
+
+			p, handler = newPlugin(false)
+			c.So(p.Enable(), ShouldBeNil)
+			for _, title := range []string{"first", "second"} {
+				select {
+				case msg := <-handler:
+					c.So(msg.Title, ShouldEqual, title)
+				case <-time.After(1 * time.Second):
+					t.Fatal("timeout")
+				}
+			}
+			p.storage.mutex.Lock()
+			c.So(p.storage.data.OfflineQueue, ShouldBeEmpty)
+			p.storage.mutex.Unlock()
+		})
+		c.Convey("delivers a digest", func(c C) {
+			p, handler := newPlugin(true)
+			p.recvMessage(broadcast("first"))
+			p.recvMessage(broadcast("second"))
+			c.So(p.Enable(), ShouldBeNil)
+			select {
+			case msg := <-handler:
+				c.So(msg.Title, ShouldContainSubstring, "2 broadcasts")
+				c.So(msg.Message, ShouldContainSubstring, "[test_channel] sender: first")
+				c.So(msg.Message, ShouldContainSubstring, "[test_channel] sender: second")
+				c.So(msg.Priority, ShouldEqual, 3)
+			case <-time.After(1 * time.Second):
+				t.Fatal("timeout")
+			}
+		})
+		c.Convey("discards stale broadcasts", func(c C) {
+			p, handler := newPlugin(false)
+			expired := broadcast("expired")
+			expired.ExpiresAt = time.Now().Add(50 * time.Millisecond)
+			p.recvMessage(expired)
+			old := broadcast("old")
+			old.Timestamp = time.Now().Add(-2 * time.Hour)
+			p.recvMessage(old)
+			p.recvMessage(broadcast("fresh"))
+			time.Sleep(100 * time.Millisecond)
+
+			config := p.DefaultConfig().(*Config)
+			config.OfflineQueue.Enabled = true
+			config.MaxAge = time.Hour
+			c.So(p.ValidateAndSetConfig(config), ShouldBeNil)
+			c.So(p.Enable(), ShouldBeNil)
+			select {
+			case msg := <-handler:
+				c.So(msg.Title, ShouldEqual, "fresh")
+			case <-time.After(1 * time.Second):
+				t.Fatal("timeout")
+			}
+			time.Sleep(100 * time.Millisecond)
+			c.So(handler, ShouldBeEmpty)
+		})
+		c.Convey("does not queue unless opted in", func(c C) {
+			p, handler := newPlugin(false)
+			config := p.DefaultConfig().(*Config)
+			c.So(p.ValidateAndSetConfig(config), ShouldBeNil)
+			p.recvMessage(broadcast("first"))
+			c.So(p.Enable(), ShouldBeNil)
+			time.Sleep(100 * time.Millisecond)
+			c.So(handler, ShouldBeEmpty)
+		})
+	})
+}
+
+func TestTrimOfflineQueue(t *testing.T) {
+	Convey("Test Trimming Offline Queue", t, func(c C) {
+		now := time.Now()
+		queue := []model.Message{
+			{ID: "stale", Timestamp: now.Add(-2 * time.Hour)},
+			{ID: "1", Timestamp: now.Add(-3 * time.Minute)},
+			{ID: "2", Timestamp: now.Add(-2 * time.Minute)},
+			{ID: "3", Timestamp: now.Add(-1 * time.Minute)},
+		}
+		res := trimOfflineQueue(queue, OfflineQueueConfig{MaxMessages: 2, MaxAge: time.Hour}, now)
+		c.So(res, ShouldHaveLength, 2)
+		c.So(res[0].ID, ShouldEqual, "2")
+		c.So(res[1].ID, ShouldEqual, "3")
+	})
+}
@@ -1,32 +1,95 @@
 package main
 
 import (
+	"sync"
+	"sync/atomic"
+
 	"github.com/gotify/plugin-api"
 )
 
 // Plugin is plugin instance
 type Plugin struct {
+	// state holds a *pluginState, which is replaced as a whole on every change
+	state      atomic.Value
+	stateMutex sync.Mutex
+	storage    pluginStorage
+	basePath   string
+	// serverURL holds the *url.URL of the server last passed to GetDisplay
+	serverURL atomic.Value
+
+	sentBroadcasts dedupCache
+	recvBroadcasts dedupCache
+	repeats        coalescer
+	quota          quotaLimiter
+
+	// schedulerWake is signaled when scheduled broadcasts or the enabled state change
+	schedulerWake chan struct{}
+	// stop is closed when the instance is torn down
+	stop chan struct{}
+
+	UserCtx plugin.UserContext
+}
+
+func newPlugin(ctx plugin.UserContext) *Plugin {
+	return &Plugin{
+		UserCtx:       ctx,
+		schedulerWake: make(chan struct{}, 1),
+		stop:          make(chan struct{}),
+	}
+}
+
+// teardown stops the background workers of an instance replaced by a new one
+func (c *Plugin) teardown() {
+	close(c.stop)
+}
+
+// pluginState is an immutable snapshot of the plugin state
+type pluginState struct {
 	config     *Config
 	enabled    bool
 	msgHandler plugin.MessageHandler
-	basePath   string
+}
 
-	UserCtx plugin.UserContext
+// loadState returns the current state snapshot, the config of which is never nil
+func (c *Plugin) loadState() *pluginState {
+	if state, ok := c.state.Load().(*pluginState); ok {
+		return state
+	}
+	return &pluginState{config: new(Config)}
+}
+
+// updateState applies a change to a copy of the current state and publishes it
+func (c *Plugin) updateState(update func(state *pluginState)) {
+	c.stateMutex.Lock()
+	defer c.stateMutex.Unlock()
+
+	state := *c.loadState()
+	update(&state)
+	c.state.Store(&state)
 }
 
 // Enable implements plugin.Plugin
 func (c *Plugin) Enable() error {
-	c.enabled = true
+	c.updateState(func(state *pluginState) {
+		state.enabled = true
+	})
+	go c.flushOfflineQueue()
+	c.wakeScheduler()
 	return nil
 }
 
 // Disable implements plugin.Disable
 func (c *Plugin) Disable() error {
-	c.enabled = false
+	c.updateState(func(state *pluginState) {
+		state.enabled = false
+	})
+	c.wakeScheduler()
 	return nil
 }
 
 // SetMessageHandler implements plugin.Messenger
 func (c *Plugin) SetMessageHandler(h plugin.MessageHandler) {
-	c.msgHandler = h
+	c.updateState(func(state *pluginState) {
+		state.msgHandler = h
+	})
 }
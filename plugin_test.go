@@ -0,0 +1,167 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
+	"github.com/eternal-flame-AD/gotify-broadcast/rules"
+	plugin "github.com/gotify/plugin-api"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+// removeTestUser tears down a plugin instance created with NewGotifyPluginInstance
+// and removes everything the user registered on the server
+func removeTestUser(id uint) {
+	if p := usersList.RemoveUser(id); p != nil {
+		p.teardown()
+	}
+	msgExchanger.Unsubscribe(id)
+	publicChannels.UpdateChannelsForUser(plugin.UserContext{ID: id}, nil)
+	publicChannels.UpdateSubscriptionsForUser(plugin.UserContext{ID: id}, nil)
+	serverQuota.set(id, Quota{})
+}
+
+// lastTestUserID is the last ID handed out by nextTestUserID, above the IDs of plugins created without a user pool entry
+var lastTestUserID uint32 = 100000
+
+// nextTestUserID returns an ID no other test user has
+func nextTestUserID() uint {
+	return uint(atomic.AddUint32(&lastTestUserID, 1))
+}
+
+// newTestUser creates an enabled plugin instance with memory storage for a new user, configured by configure if it is not nil.
+// The user is removed once the Convey block of c finishes.
+func newTestUser(c C, name string, configure func(config *Config)) (*Plugin, recordingHandler) {
+	id := nextTestUserID()
+	p := NewGotifyPluginInstance(plugin.UserContext{ID: id, Name: name}).(*Plugin)
+	c.Reset(func() {
+		removeTestUser(id)
+	})
+	p.SetStorageHandler(new(memoryStorage))
+	handler := make(recordingHandler, 10)
+	p.SetMessageHandler(handler)
+	config := p.DefaultConfig().(*Config)
+	if configure != nil {
+		configure(config)
+	}
+	c.So(p.ValidateAndSetConfig(config), ShouldBeNil)
+	c.So(p.Enable(), ShouldBeNil)
+	return p, handler
+}
+
+func TestPluginState(t *testing.T) {
+	Convey("Test Plugin State", t, func(c C) {
+		p := &Plugin{
+			UserCtx: plugin.UserContext{ID: 2001, Name: "state"},
+		}
+		handler := make(recordingHandler, 1000)
+		c.Convey("receives without config", func(c C) {
+			c.So(func() {
+				p.recvMessage(model.Message{})
+			}, ShouldNotPanic)
+			p.SetMessageHandler(handler)
+			c.So(p.Enable(), ShouldBeNil)
+			p.recvMessage(model.Message{})
+			c.So(handler, ShouldHaveLength, 1)
+		})
+		c.Convey("sends without config", func(c C) {
+			c.So(func() {
+				channel := ChannelDef{Name: "example"}
+				p.sendMessage(channel, p.newBroadcast(plugin.Message{}, channel, model.OriginAPI))
+			}, ShouldNotPanic)
+		})
+		c.Convey("snapshots are isolated", func(c C) {
+			c.So(p.ValidateAndSetConfig(p.DefaultConfig()), ShouldBeNil)
+			before := p.loadState()
+			c.So(p.Enable(), ShouldBeNil)
+			c.So(before.enabled, ShouldBeFalse)
+			c.So(p.loadState().enabled, ShouldBeTrue)
+			c.So(p.loadState().config, ShouldEqual, before.config)
+		})
+		c.Convey("validates channel names", func(c C) {
+			config := p.DefaultConfig().(*Config)
+			config.Channels = []ChannelDef{{Name: "ops.db.primary"}}
+			c.So(p.ValidateAndSetConfig(config), ShouldBeNil)
+			config.Channels = []ChannelDef{{Name: "ops..db"}}
+			c.So(p.ValidateAndSetConfig(config), ShouldNotBeNil)
+			config.Channels = []ChannelDef{{Name: "ops.*"}}
+			c.So(p.ValidateAndSetConfig(config), ShouldNotBeNil)
+		})
+		c.Convey("concurrent config updates and broadcasts", func(c C) {
+			p.SetMessageHandler(handler)
+			wg := new(sync.WaitGroup)
+			for i := 0; i < 4; i++ {
+				wg.Add(3)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						_ = p.ValidateAndSetConfig(p.DefaultConfig())
+					}
+				}()
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						if j%2 == 0 {
+							_ = p.Enable()
+						} else {
+							_ = p.Disable()
+						}
+					}
+				}()
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						p.recvMessage(model.Message{Sender: plugin.UserContext{ID: 1}})
+					}
+				}()
+			}
+			wg.Wait()
+			// the handler holds all 400 broadcasts, drained here once nothing else receives from it
+			for len(handler) > 0 {
+				<-handler
+			}
+			publicChannels.UpdateChannelsForUser(p.UserCtx, nil)
+		})
+	})
+}
+
+func TestDeliveryReport(t *testing.T) {
+	Convey("Test Delivery Report", t, func(c C) {
+		sender, _ := newTestUser(c, "sender", func(config *Config) {
+			config.ReceiverFilter = rules.RuleChain{{
+				Match:  rules.MatchSet{{Mode: rules.ModeUserName, UserName: "muted"}},
+				Action: rules.Reject,
+			}}
+		})
+		disabled, _ := newTestUser(c, "disabled", nil)
+		c.So(disabled.Disable(), ShouldBeNil)
+		newTestUser(c, "picky", func(config *Config) {
+			config.SenderFilter = rules.RuleChain{{
+				Match:  rules.MatchSet{{Mode: rules.ModeAny}},
+				Action: rules.Reject,
+			}}
+		})
+		newTestUser(c, "muted", nil)
+
+		channel := ChannelDef{Name: "example"}
+		broadcast := sender.newBroadcast(plugin.Message{Message: "hello"}, channel, model.OriginAPI)
+		report := sender.sendMessage(channel, broadcast)
+		c.So(report.ID, ShouldEqual, broadcast.ID)
+		statuses := make(map[string]DeliveryStatus)
+		for _, recipient := range report.Recipients {
+			statuses[recipient.UserName] = recipient.Status
+		}
+		c.So(statuses["sender"], ShouldEqual, StatusDelivered)
+		c.So(statuses["disabled"], ShouldEqual, StatusRecipientDisabled)
+		c.So(statuses["picky"], ShouldEqual, StatusRejectedBySenderFilter)
+		c.So(statuses["muted"], ShouldEqual, StatusRejectedByReceiverFilter)
+		c.So(report.Counts[StatusDelivered], ShouldBeGreaterThanOrEqualTo, 1)
+
+		redacted := report.redacted()
+		c.So(redacted.Recipients, ShouldBeEmpty)
+		c.So(redacted.Counts, ShouldResemble, report.Counts)
+	})
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"strings"
 	"sync"
 
 	plugin "github.com/gotify/plugin-api"
@@ -10,8 +11,9 @@ var publicChannels = new(PublicChannelListManager)
 
 // PublicChannelListManager holds a registry of public channels at a server scope
 type PublicChannelListManager struct {
-	mutex    sync.RWMutex
-	channels []ChannelWithUserContext
+	mutex         sync.RWMutex
+	channels      []ChannelWithUserContext
+	subscriptions map[uint][]string
 }
 
 // UpdateChannelsForUser replaces all public channels belonging to a user context with a new slice of channels
@@ -47,6 +49,52 @@ func (c *PublicChannelListManager) GetAllChannels() []ChannelWithUserContext {
 	return res
 }
 
+// UpdateSubscriptionsForUser replaces the channels a user subscribes to
+func (c *PublicChannelListManager) UpdateSubscriptionsForUser(userCtx plugin.UserContext, subscriptions []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if len(subscriptions) == 0 {
+		delete(c.subscriptions, userCtx.ID)
+		return
+	}
+	if c.subscriptions == nil {
+		c.subscriptions = make(map[uint][]string)
+	}
+	c.subscriptions[userCtx.ID] = append([]string(nil), subscriptions...)
+}
+
+// SubscriberCount gets the number of users subscribing to a channel of owner, directly or with wildcards
+func (c *PublicChannelListManager) SubscriberCount(owner plugin.UserContext, channel string) int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	count := 0
+	for _, subscriptions := range c.subscriptions {
+		for _, sub := range subscriptions {
+			if subscriptionMatches(sub, owner, channel) {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+// GetSubtree gets all public channels named root or below root in the dotted hierarchy
+func (c *PublicChannelListManager) GetSubtree(root string) []ChannelWithUserContext {
+	res := make([]ChannelWithUserContext, 0)
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for _, ch := range c.channels {
+		if ch.Channel.Name == root || strings.HasPrefix(ch.Channel.Name, root+".") {
+			res = append(res, ch)
+		}
+	}
+	return res
+}
+
 // ChannelWithUserContext wraps a ChannelDef with the user context that possesses it
 type ChannelWithUserContext struct {
 	Channel     ChannelDef
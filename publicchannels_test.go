@@ -42,8 +42,8 @@ func TestPublicChannels(t *testing.T) {
 				Name:  "test",
 				Admin: true,
 			}, []ChannelDef{
-				{"test_channel", true},
-				{"test_private_channel", false},
+				{Name: "test_channel", Public: true},
+				{Name: "test_private_channel", Public: false},
 			})
 			c.So(registry.GetAllChannels(), ShouldHaveLength, 1)
 			c.So(registry.GetAllChannels(), shouldAllBePublicChannel)
@@ -54,12 +54,36 @@ func TestPublicChannels(t *testing.T) {
 				Name:  "test",
 				Admin: true,
 			}, []ChannelDef{
-				{"test_private_channel", true},
-				{"test_public_channel", true},
+				{Name: "test_private_channel", Public: true},
+				{Name: "test_public_channel", Public: true},
 			})
 			c.So(registry.GetAllChannels(), ShouldHaveLength, 2)
 			c.So(registry.GetAllChannels(), shouldAllBePublicChannel)
 		})
+		c.Convey("counts subscribers", func(c C) {
+			owner := plugin.UserContext{ID: 1, Name: "test"}
+			registry.UpdateSubscriptionsForUser(plugin.UserContext{ID: 2}, []string{"test/test_channel", "test/other"})
+			registry.UpdateSubscriptionsForUser(plugin.UserContext{ID: 3}, []string{"test/test_channel"})
+			registry.UpdateSubscriptionsForUser(plugin.UserContext{ID: 4}, []string{"test/ops.>"})
+			c.So(registry.SubscriberCount(owner, "test_channel"), ShouldEqual, 2)
+			c.So(registry.SubscriberCount(owner, "other"), ShouldEqual, 1)
+			c.So(registry.SubscriberCount(owner, "ops.db"), ShouldEqual, 1)
+			c.So(registry.SubscriberCount(plugin.UserContext{ID: 5, Name: "else"}, "ops.db"), ShouldEqual, 0)
+			registry.UpdateSubscriptionsForUser(plugin.UserContext{ID: 2}, nil)
+			c.So(registry.SubscriberCount(owner, "test_channel"), ShouldEqual, 1)
+			c.So(registry.SubscriberCount(owner, "other"), ShouldEqual, 0)
+		})
+		c.Convey("lists a subtree", func(c C) {
+			registry.UpdateChannelsForUser(plugin.UserContext{ID: 1, Name: "test"}, []ChannelDef{
+				{Name: "ops", Public: true},
+				{Name: "ops.db", Public: true},
+				{Name: "ops.db.primary", Public: true},
+				{Name: "opsec", Public: true},
+			})
+			c.So(registry.GetSubtree("ops"), ShouldHaveLength, 3)
+			c.So(registry.GetSubtree("ops.db"), ShouldHaveLength, 2)
+			c.So(registry.GetSubtree("dev"), ShouldBeEmpty)
+		})
 		c.Convey("sync safety", func(c C) {
 
 			registry.UpdateChannelsForUser(plugin.UserContext{
@@ -67,8 +91,8 @@ func TestPublicChannels(t *testing.T) {
 				Name:  "test_1",
 				Admin: true,
 			}, []ChannelDef{
-				{"test_channel", true},
-				{"test_private_channel", false},
+				{Name: "test_channel", Public: true},
+				{Name: "test_private_channel", Public: false},
 			})
 
 			generaterChan := make(chan struct{})
@@ -79,16 +103,16 @@ func TestPublicChannels(t *testing.T) {
 						Name:  "test_1",
 						Admin: true,
 					}, []ChannelDef{
-						{"test_channel", true},
-						{"test_private_channel", false},
+						{Name: "test_channel", Public: true},
+						{Name: "test_private_channel", Public: false},
 					})
 					registry.UpdateChannelsForUser(plugin.UserContext{
 						ID:    uint(i),
 						Name:  "test_" + strconv.Itoa(i),
 						Admin: true,
 					}, []ChannelDef{
-						{"test_channel", true},
-						{"test_private_channel", false},
+						{Name: "test_channel", Public: true},
+						{Name: "test_private_channel", Public: false},
 					})
 				}
 				close(generaterChan)
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
+	"github.com/eternal-flame-AD/gotify-broadcast/rules"
+)
+
+// QuietHoursConfig configures a daily period during which received broadcasts are held and delivered afterwards
+type QuietHoursConfig struct {
+	// Start and End are the times of the day quiet hours begin and end, formatted as 15:04
+	Start string `yaml:"start,omitempty"`
+	End   string `yaml:"end,omitempty"`
+	// Timezone is the IANA time zone Start and End are in, defaults to the time zone of the server
+	Timezone string `yaml:"timezone,omitempty"`
+	// Match restricts quiet hours to matching broadcasts, all broadcasts are held if empty
+	Match rules.MatchSet `yaml:"match,omitempty"`
+	// BreakThroughPriority delivers broadcasts with at least this priority immediately
+	BreakThroughPriority *int `yaml:"break_through_priority,omitempty"`
+	// Summarize delivers held broadcasts as a single summary when quiet hours end
+	Summarize bool `yaml:"summarize,omitempty"`
+}
+
+func (c QuietHoursConfig) enabled() bool {
+	return c.Start != "" && c.End != "" && c.Start != c.End
+}
+
+// Check checks a QuietHoursConfig for errors
+func (c QuietHoursConfig) Check() error {
+	if c.Start == "" && c.End == "" {
+		return nil
+	}
+	if c.Start == "" || c.End == "" {
+		return errors.New("quiet hours require both start and end")
+	}
+	for _, clock := range []string{c.Start, c.End} {
+		if _, err := time.Parse("15:04", clock); err != nil {
+			return fmt.Errorf("invalid quiet hours time %s, expected HH:MM", clock)
+		}
+	}
+	if _, err := time.LoadLocation(c.Timezone); err != nil {
+		return fmt.Errorf("invalid quiet hours timezone: %s", err.Error())
+	}
+	return c.Match.Check()
+}
+
+func (c QuietHoursConfig) location() *time.Location {
+	if c.Timezone == "" {
+		return time.Local
+	}
+	if loc, err := time.LoadLocation(c.Timezone); err == nil {
+		return loc
+	}
+	return time.Local
+}
+
+func minuteOfDay(clock string) int {
+	t, _ := time.Parse("15:04", clock)
+	return t.Hour()*60 + t.Minute()
+}
+
+// active reports whether now is within quiet hours
+func (c QuietHoursConfig) active(now time.Time) bool {
+	if !c.enabled() {
+		return false
+	}
+	now = now.In(c.location())
+	m := now.Hour()*60 + now.Minute()
+	start, end := minuteOfDay(c.Start), minuteOfDay(c.End)
+	if start < end {
+		return m >= start && m < end
+	}
+	return m >= start || m < end
+}
+
+// end returns the first end of quiet hours after now
+func (c QuietHoursConfig) end(now time.Time) time.Time {
+	local := now.In(c.location())
+	end := minuteOfDay(c.End)
+	res := time.Date(local.Year(), local.Month(), local.Day(), end/60, end%60, 0, 0, local.Location())
+	if !res.After(local) {
+		res = res.AddDate(0, 0, 1)
+	}
+	return res
+}
+
+// holds reports whether a broadcast received at now is held until quiet hours end
+func (c QuietHoursConfig) holds(msg model.Message, now time.Time) bool {
+	if !c.active(now) {
+		return false
+	}
+	if c.BreakThroughPriority != nil && msg.Msg.Priority >= *c.BreakThroughPriority {
+		return false
+	}
+	return len(c.Match) == 0 || c.Match.Match(msg)
+}
+
+func (c *Plugin) holdMessage(msg model.Message) {
+	_ = c.storage.update(func(data *storedData) {
+		data.Held = append(data.Held, msg)
+	})
+	c.wakeScheduler()
+}
+
+// nextRelease returns the time held broadcasts are released, ok is false if no broadcast is held
+func (c *Plugin) nextRelease() (next time.Time, ok bool) {
+	config := c.loadState().config.QuietHours
+	c.storage.view(func(data *storedData) {
+		if len(data.Held) > 0 {
+			ok = true
+		}
+	})
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if !config.active(now) {
+		return now, true
+	}
+	return config.end(now), true
+}
+
+// releaseHeld delivers held broadcasts if quiet hours are over at now
+func (c *Plugin) releaseHeld(now time.Time) {
+	state := c.loadState()
+	if !state.enabled || state.msgHandler == nil || state.config.QuietHours.active(now) {
+		return
+	}
+	var msgs []model.Message
+	_ = c.storage.update(func(data *storedData) {
+		for _, msg := range data.Held {
+			if !isStale(state.config, msg, now) {
+				msgs = append(msgs, msg)
+			}
+		}
+		data.Held = nil
+	})
+	if len(msgs) == 0 {
+		return
+	}
+	if !state.config.QuietHours.Summarize {
+		for _, msg := range msgs {
+			c.deliver(state, msg)
+		}
+		return
+	}
+	if summary, err := renderDigest(DigestConfig{}, msgs); err == nil {
+		summary.Title = fmt.Sprintf("%d broadcasts held during quiet hours", len(msgs))
+		_ = state.msgHandler.SendMessage(summary)
+	}
+}
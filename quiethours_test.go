@@ -0,0 +1,98 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
+	"github.com/eternal-flame-AD/gotify-broadcast/rules"
+	plugin "github.com/gotify/plugin-api"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestQuietHoursConfig(t *testing.T) {
+	Convey("Test Quiet Hours Config", t, func(c C) {
+		at := func(hour, minute int) time.Time {
+			return time.Date(2020, time.January, 1, hour, minute, 0, 0, time.UTC)
+		}
+		c.Convey("overnight", func(c C) {
+			config := QuietHoursConfig{Start: "22:00", End: "07:00", Timezone: "UTC"}
+			c.So(config.active(at(23, 0)), ShouldBeTrue)
+			c.So(config.active(at(6, 59)), ShouldBeTrue)
+			c.So(config.active(at(7, 0)), ShouldBeFalse)
+			c.So(config.active(at(12, 0)), ShouldBeFalse)
+			c.So(config.end(at(23, 0)), ShouldEqual, time.Date(2020, time.January, 2, 7, 0, 0, 0, time.UTC))
+			c.So(config.end(at(1, 0)), ShouldEqual, at(7, 0))
+		})
+		c.Convey("same day", func(c C) {
+			config := QuietHoursConfig{Start: "12:00", End: "13:30", Timezone: "UTC"}
+			c.So(config.active(at(12, 0)), ShouldBeTrue)
+			c.So(config.active(at(13, 30)), ShouldBeFalse)
+			c.So(config.active(at(11, 0)), ShouldBeFalse)
+		})
+		c.Convey("timezone", func(c C) {
+			config := QuietHoursConfig{Start: "22:00", End: "07:00", Timezone: "Asia/Tokyo"}
+			c.So(config.active(at(14, 0)), ShouldBeTrue)
+			c.So(config.active(at(22, 0)), ShouldBeFalse)
+		})
+		c.Convey("disabled", func(c C) {
+			c.So(QuietHoursConfig{}.active(at(12, 0)), ShouldBeFalse)
+		})
+		c.Convey("holds", func(c C) {
+			threshold := 8
+			config := QuietHoursConfig{
+				Start:                "22:00",
+				End:                  "07:00",
+				Timezone:             "UTC",
+				Match:                rules.MatchSet{{Mode: rules.ModeChannelName, ChannelName: "ops"}},
+				BreakThroughPriority: &threshold,
+			}
+			c.So(config.holds(model.Message{Channel: ChannelInfo{Name: "ops"}}, at(23, 0)), ShouldBeTrue)
+			c.So(config.holds(model.Message{Channel: ChannelInfo{Name: "ops"}}, at(12, 0)), ShouldBeFalse)
+			c.So(config.holds(model.Message{Channel: ChannelInfo{Name: "dev"}}, at(23, 0)), ShouldBeFalse)
+			c.So(config.holds(model.Message{Channel: ChannelInfo{Name: "ops"}, Msg: plugin.Message{Priority: 9}}, at(23, 0)), ShouldBeFalse)
+		})
+		c.Convey("check", func(c C) {
+			c.So(QuietHoursConfig{}.Check(), ShouldBeNil)
+			c.So(QuietHoursConfig{Start: "22:00"}.Check(), ShouldNotBeNil)
+			c.So(QuietHoursConfig{Start: "22:00", End: "7am"}.Check(), ShouldNotBeNil)
+			c.So(QuietHoursConfig{Start: "22:00", End: "07:00", Timezone: "Mars/Olympus"}.Check(), ShouldNotBeNil)
+			c.So(QuietHoursConfig{Start: "22:00", End: "07:00", Timezone: "Europe/Berlin"}.Check(), ShouldBeNil)
+		})
+	})
+}
+
+func TestQuietHoursDelivery(t *testing.T) {
+	Convey("Test Quiet Hours Delivery", t, func(c C) {
+		p := &Plugin{UserCtx: plugin.UserContext{ID: 8001, Name: "quiet"}}
+		p.SetStorageHandler(new(memoryStorage))
+		handler := make(recordingHandler, 10)
+		p.SetMessageHandler(handler)
+		now := time.Now().UTC()
+		config := p.DefaultConfig().(*Config)
+		threshold := 8
+		config.QuietHours = QuietHoursConfig{
+			Start:                now.Add(-time.Hour).Format("15:04"),
+			End:                  now.Add(time.Hour).Format("15:04"),
+			Timezone:             "UTC",
+			BreakThroughPriority: &threshold,
+		}
+		c.So(p.ValidateAndSetConfig(config), ShouldBeNil)
+		c.So(p.Enable(), ShouldBeNil)
+
+		c.So(p.screenMessage(model.Message{Msg: plugin.Message{Title: "held"}, Timestamp: now}), ShouldEqual, StatusHeld)
+		c.So(p.screenMessage(model.Message{Msg: plugin.Message{Title: "urgent", Priority: 9}, Timestamp: now}), ShouldEqual, StatusDelivered)
+		next, ok := p.nextRelease()
+		c.So(ok, ShouldBeTrue)
+		c.So(next.After(now), ShouldBeTrue)
+
+		p.releaseHeld(now)
+		c.So(handler, ShouldBeEmpty)
+		p.releaseHeld(now.Add(90 * time.Minute))
+		c.So(handler, ShouldHaveLength, 1)
+		c.So((<-handler).Title, ShouldEqual, "held")
+		_, ok = p.nextRelease()
+		c.So(ok, ShouldBeFalse)
+	})
+}
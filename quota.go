@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
+	"github.com/eternal-flame-AD/gotify-broadcast/rules"
+)
+
+// Quota limits broadcasts sent through a channel
+type Quota = model.Quota
+
+var serverQuota = new(quotaCeilings)
+
+// quotaCeilings holds the server-wide quotas set by admins, the strictest of them applies to every channel
+type quotaCeilings struct {
+	mutex    sync.RWMutex
+	ceilings map[uint]Quota
+}
+
+func (c *quotaCeilings) set(userID uint, quota Quota) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if quota == (Quota{}) {
+		delete(c.ceilings, userID)
+		return
+	}
+	if c.ceilings == nil {
+		c.ceilings = make(map[uint]Quota)
+	}
+	c.ceilings[userID] = quota
+}
+
+func (c *quotaCeilings) get() Quota {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var res Quota
+	for _, ceiling := range c.ceilings {
+		res = res.Within(ceiling)
+	}
+	return res
+}
+
+func checkQuota(quota Quota) error {
+	if quota.PerMinute < 0 || quota.PerHour < 0 || quota.PerDay < 0 || quota.MaxRecipients < 0 {
+		return errors.New("quota limits must not be negative")
+	}
+	return nil
+}
+
+// quotaLimiter remembers when broadcasts were sent through each channel
+type quotaLimiter struct {
+	mutex sync.Mutex
+	sent  map[string][]time.Time
+}
+
+// allow reports whether the quota permits a broadcast through the channel and records it if record is set,
+// otherwise it returns how long to wait until the quota permits another one
+func (l *quotaLimiter) allow(channel string, quota Quota, now time.Time, record bool) (retryAfter time.Duration, ok bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	limits := []struct {
+		count  int
+		period time.Duration
+	}{
+		{quota.PerMinute, time.Minute},
+		{quota.PerHour, time.Hour},
+		{quota.PerDay, 24 * time.Hour},
+	}
+	var longest time.Duration
+	for _, limit := range limits {
+		if limit.count > 0 {
+			longest = limit.period
+		}
+	}
+	if longest == 0 {
+		return 0, true
+	}
+	if l.sent == nil {
+		l.sent = make(map[string][]time.Time)
+	}
+
+	sent := l.sent[channel]
+	for len(sent) > 0 && !sent[0].After(now.Add(-longest)) {
+		sent = sent[1:]
+	}
+	for _, limit := range limits {
+		if limit.count == 0 {
+			continue
+		}
+		var inPeriod []time.Time
+		for i, t := range sent {
+			if t.After(now.Add(-limit.period)) {
+				inPeriod = sent[i:]
+				break
+			}
+		}
+		if len(inPeriod) >= limit.count {
+			if wait := inPeriod[len(inPeriod)-limit.count].Add(limit.period).Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+		}
+	}
+	if retryAfter > 0 {
+		l.sent[channel] = sent
+		return retryAfter, false
+	}
+	if record {
+		sent = append(sent, now)
+	}
+	l.sent[channel] = sent
+	return 0, true
+}
+
+// channelQuota returns the quota of a channel within the server-wide ceiling
+func channelQuota(channel ChannelDef) Quota {
+	return channel.Quota.Within(serverQuota.get())
+}
+
+// errRateLimited means the rate limits of a channel quota are exhausted
+type errRateLimited struct {
+	retryAfter time.Duration
+}
+
+func (c errRateLimited) Error() string {
+	return "channel quota exceeded"
+}
+
+// errTooManyRecipients means a broadcast would reach more users than the channel quota allows
+type errTooManyRecipients struct {
+	count int
+	max   int
+}
+
+func (c errTooManyRecipients) Error() string {
+	return fmt.Sprintf("broadcast would reach %d recipients, the channel quota allows %d", c.count, c.max)
+}
+
+// enforceQuota checks a broadcast through a channel of the user against the channel quota,
+// the broadcast is counted against the rate limits if count is set and the quota permits it
+func (c *Plugin) enforceQuota(channel ChannelDef, broadcast model.Message, count bool) error {
+	quota := channelQuota(channel)
+	if quota.MaxRecipients > 0 {
+		if n := c.countRecipients(channel, broadcast); n > quota.MaxRecipients {
+			return errTooManyRecipients{n, quota.MaxRecipients}
+		}
+	}
+	if retryAfter, ok := c.quota.allow(channel.Name, quota, time.Now(), count); !ok {
+		return errRateLimited{retryAfter}
+	}
+	return nil
+}
+
+// countRecipients returns how many users a broadcast would be published to
+func (c *Plugin) countRecipients(channel ChannelDef, broadcast model.Message) int {
+	config := c.loadState().config
+	isMember := c.memberFilter(channel)
+	count := 0
+	for _, recipient := range usersList.GetUsersList() {
+		msgWrapped := broadcast
+		msgWrapped.Receiver = recipient
+		msgWrapped.IsSend = true
+		if isMember(recipient) && config.ReceiverFilter.Match(msgWrapped, rules.Accept) == rules.Accept {
+			count++
+		}
+	}
+	return count
+}
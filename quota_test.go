@@ -0,0 +1,131 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	plugin "github.com/gotify/plugin-api"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestQuotaLimiter(t *testing.T) {
+	Convey("Test Quota Limiter", t, func(c C) {
+		l := new(quotaLimiter)
+		now := time.Date(2020, time.January, 1, 12, 0, 0, 0, time.UTC)
+		quota := Quota{PerMinute: 2, PerHour: 3}
+
+		_, ok := l.allow("ch", quota, now, true)
+		c.So(ok, ShouldBeTrue)
+		_, ok = l.allow("ch", quota, now.Add(10*time.Second), true)
+		c.So(ok, ShouldBeTrue)
+		retryAfter, ok := l.allow("ch", quota, now.Add(20*time.Second), true)
+		c.So(ok, ShouldBeFalse)
+		c.So(retryAfter, ShouldEqual, 40*time.Second)
+
+		_, ok = l.allow("other", quota, now.Add(20*time.Second), true)
+		c.So(ok, ShouldBeTrue)
+
+		_, ok = l.allow("ch", quota, now.Add(time.Minute), true)
+		c.So(ok, ShouldBeTrue)
+		retryAfter, ok = l.allow("ch", quota, now.Add(5*time.Minute), true)
+		c.So(ok, ShouldBeFalse)
+		c.So(retryAfter, ShouldEqual, 55*time.Minute)
+
+		_, ok = l.allow("ch", quota, now.Add(time.Hour), true)
+		c.So(ok, ShouldBeTrue)
+		_, ok = l.allow("ch", Quota{}, now.Add(time.Hour), true)
+		c.So(ok, ShouldBeTrue)
+	})
+}
+
+func TestServerQuota(t *testing.T) {
+	Convey("Test Server Quota", t, func(c C) {
+		user := &Plugin{UserCtx: plugin.UserContext{ID: 10001, Name: "user"}}
+		config := user.DefaultConfig().(*Config)
+		config.ServerQuota = Quota{PerMinute: 1}
+		c.So(user.ValidateAndSetConfig(config), ShouldNotBeNil)
+		config.ServerQuota = Quota{}
+		config.Channels = []ChannelDef{{Name: "example", Quota: Quota{PerDay: -1}}}
+		c.So(user.ValidateAndSetConfig(config), ShouldNotBeNil)
+
+		admin := &Plugin{UserCtx: plugin.UserContext{ID: 10002, Name: "admin", Admin: true}}
+		adminConfig := admin.DefaultConfig().(*Config)
+		adminConfig.ServerQuota = Quota{PerMinute: 1}
+		c.So(admin.ValidateAndSetConfig(adminConfig), ShouldBeNil)
+		defer serverQuota.set(10002, Quota{})
+		c.So(channelQuota(ChannelDef{Quota: Quota{PerMinute: 5, PerHour: 10}}), ShouldResemble, Quota{PerMinute: 1, PerHour: 10})
+
+		config.Channels = []ChannelDef{{Name: "example"}}
+		c.So(user.ValidateAndSetConfig(config), ShouldBeNil)
+		engine := newTestWebhook(user)
+		c.So(postJSON(engine, "/message?channel=example", `{"message": "hello"}`, nil).Code, ShouldEqual, http.StatusOK)
+		w := postJSON(engine, "/message?channel=example", `{"message": "hello"}`, nil)
+		c.So(w.Code, ShouldEqual, http.StatusTooManyRequests)
+		c.So(w.Header().Get("Retry-After"), ShouldNotBeEmpty)
+
+		c.Convey("retries with an idempotency key", func(c C) {
+			serverQuota.set(10002, Quota{})
+			config.Channels = []ChannelDef{{Name: "keyed", Quota: Quota{PerMinute: 1}}}
+			c.So(user.ValidateAndSetConfig(config), ShouldBeNil)
+			header := map[string]string{"Idempotency-Key": "retry"}
+			first := postJSON(engine, "/message?channel=keyed", `{"message": "hello"}`, header)
+			c.So(first.Code, ShouldEqual, http.StatusOK)
+			retry := postJSON(engine, "/message?channel=keyed", `{"message": "hello"}`, header)
+			c.So(retry.Code, ShouldEqual, http.StatusOK)
+			c.So(retry.Body.String(), ShouldEqual, first.Body.String())
+			c.So(postJSON(engine, "/message?channel=keyed", `{"message": "hello"}`, nil).Code, ShouldEqual, http.StatusTooManyRequests)
+		})
+	})
+}
+
+func TestMaxRecipients(t *testing.T) {
+	Convey("Test Max Recipients", t, func(c C) {
+		for i := 0; i < 2; i++ {
+			id := nextTestUserID()
+			usersList.AddUser(plugin.UserContext{ID: id, Name: "recipient"})
+			defer usersList.RemoveUser(id)
+		}
+		p := &Plugin{UserCtx: plugin.UserContext{ID: 10010, Name: "sender"}}
+		config := p.DefaultConfig().(*Config)
+		config.Channels = []ChannelDef{{Name: "example", Quota: Quota{MaxRecipients: 1}}}
+		c.So(p.ValidateAndSetConfig(config), ShouldBeNil)
+		engine := newTestWebhook(p)
+		c.So(postJSON(engine, "/message?channel=example", `{"message": "hello"}`, nil).Code, ShouldEqual, http.StatusForbidden)
+	})
+}
+
+func TestScheduledQuota(t *testing.T) {
+	Convey("Test Quota Of Scheduled Broadcasts", t, func(c C) {
+		p, handler := newTestUser(c, "cron", func(config *Config) {
+			config.Channels = []ChannelDef{
+				{Name: "limited", Quota: Quota{PerMinute: 1}},
+				{Name: "narrow", Quota: Quota{MaxRecipients: 1}},
+			}
+		})
+		other := nextTestUserID()
+		usersList.AddUser(plugin.UserContext{ID: other, Name: "other"})
+		defer usersList.RemoveUser(other)
+
+		now := time.Now()
+		var jobs []ScheduledBroadcast
+		for _, channel := range []string{"limited", "limited", "narrow"} {
+			job, err := newScheduledBroadcast(channel, plugin.Message{Title: channel}, now.Add(-time.Second), "", 0)
+			c.So(err, ShouldBeNil)
+			jobs = append(jobs, job)
+		}
+		_ = p.storage.update(func(data *storedData) {
+			data.Scheduled = append(data.Scheduled, jobs...)
+		})
+		p.fireScheduled(now)
+		select {
+		case msg := <-handler:
+			c.So(msg.Title, ShouldEqual, "limited")
+		case <-time.After(time.Second):
+			c.So("scheduled broadcast not delivered", ShouldBeEmpty)
+		}
+		time.Sleep(100 * time.Millisecond)
+		c.So(handler, ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,63 @@
+package main
+
+const (
+	// StatusDelivered means the broadcast is accepted by the recipient and queued for delivery.
+	StatusDelivered DeliveryStatus = "delivered"
+	// StatusRejectedByReceiverFilter means the broadcast is rejected by the receiver_filter of the sender.
+	StatusRejectedByReceiverFilter DeliveryStatus = "rejected_by_receiver_filter"
+	// StatusRejectedBySenderFilter means the broadcast is rejected by the sender_filter of the recipient.
+	StatusRejectedBySenderFilter DeliveryStatus = "rejected_by_sender_filter"
+	// StatusNotMember means the channel is members-only and the recipient is not a member.
+	StatusNotMember DeliveryStatus = "not_member"
+	// StatusNotSubscribed means the recipient receives only subscribed channels and does not subscribe to this one.
+	StatusNotSubscribed DeliveryStatus = "not_subscribed"
+	// StatusRecipientDisabled means the broadcast is dropped because the recipient has disabled the plugin.
+	StatusRecipientDisabled DeliveryStatus = "recipient_disabled"
+	// StatusQueuedOffline means the recipient has disabled the plugin and the broadcast is kept in the offline queue.
+	StatusQueuedOffline DeliveryStatus = "queued_offline"
+	// StatusDigested means the broadcast is collected into the digest of the recipient.
+	StatusDigested DeliveryStatus = "digested"
+	// StatusHeld means the broadcast is held until the quiet hours of the recipient end.
+	StatusHeld DeliveryStatus = "held"
+	// StatusCoalesced means the broadcast repeats a recent one and is counted in a follow-up summary.
+	StatusCoalesced DeliveryStatus = "coalesced"
+	// StatusSuppressedDuplicate means the recipient has received an identical broadcast recently.
+	StatusSuppressedDuplicate DeliveryStatus = "suppressed_duplicate"
+	// StatusDropped means the broadcast could not be queued for the recipient.
+	StatusDropped DeliveryStatus = "dropped"
+)
+
+// DeliveryStatus is the outcome of a broadcast for a single recipient
+type DeliveryStatus string
+
+// RecipientReport is the delivery status of a broadcast for a single recipient
+type RecipientReport struct {
+	UserID   uint           `json:"user_id"`
+	UserName string         `json:"user_name"`
+	Status   DeliveryStatus `json:"status"`
+}
+
+// DeliveryReport summarizes the delivery of a broadcast
+type DeliveryReport struct {
+	ID         string                 `json:"id"`
+	Counts     map[DeliveryStatus]int `json:"counts"`
+	Recipients []RecipientReport      `json:"recipients,omitempty"`
+}
+
+func newDeliveryReport(id string) *DeliveryReport {
+	return &DeliveryReport{
+		ID:     id,
+		Counts: make(map[DeliveryStatus]int),
+	}
+}
+
+func (c *DeliveryReport) add(recipient RecipientReport) {
+	c.Counts[recipient.Status]++
+	c.Recipients = append(c.Recipients, recipient)
+}
+
+// redacted returns a copy of the report without per-recipient details
+func (c DeliveryReport) redacted() DeliveryReport {
+	c.Recipients = nil
+	return c
+}
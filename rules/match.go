@@ -2,6 +2,7 @@ package rules
 
 import (
 	"fmt"
+	"net"
 	"reflect"
 	"strings"
 
@@ -14,6 +15,9 @@ const (
 	Accept Action = "accept"
 	// Reject drops the message.
 	Reject Action = "reject"
+	// Digest collects the message into a periodic digest instead of delivering it immediately.
+	// Only available in the sender filter.
+	Digest Action = "digest"
 )
 
 // Action describes how the message is handled after matching a RuleSet.
@@ -26,8 +30,26 @@ const (
 
 	// ModeChannelName matches the channel name the message is sent through.
 	// Use parameter channel_name to specity the channel name to match.
+	// Without regex, the wildcards '*' and '>' match one or all remaining dot separated tokens of the name.
 	// Use parameter regex: true to enable regex matching.
 	ModeChannelName Mode = "channel_name"
+	// ModeChannelTag matches the tags of the channel the message is sent through, the mode matches if any tag matches.
+	// Use parameter channel_tag to specify the tag to match.
+	// Use parameter regex: true to enable regex matching.
+	ModeChannelTag Mode = "channel_tag"
+	// ModeChannelPublic matches whether the channel the message is sent through is public.
+	// Use parameter channel_public to specify whether to match public or private channels.
+	ModeChannelPublic Mode = "channel_public"
+	// ModeChannelOwnerName matches the user name of the owner of the channel.
+	// Use parameter channel_owner_name to specify the user name to match.
+	// Use parameter regex: true to enable regex matching.
+	ModeChannelOwnerName Mode = "channel_owner_name"
+	// ModeChannelOwnerID matches the user ID of the owner of the channel.
+	// Use parameter channel_owner_id to specify the user ID to match.
+	ModeChannelOwnerID Mode = "channel_owner_id"
+	// ModeChannelOwnerIsAdmin matches whether the owner of the channel is an admin.
+	// Use parameter channel_owner_is_admin to specify whether to match admins or non-admins.
+	ModeChannelOwnerIsAdmin Mode = "channel_owner_is_admin"
 	// ModeUserName matches the user name of the message (matches the sender on the recipient side and matches the recipient on the sender side).
 	// Use parameter user_name to specify the user name to match.
 	// Use parameter regex: true to enable regex matching.
@@ -40,6 +62,20 @@ const (
 	// Use parameter is_admin to specity whether to match admins or non-admins.
 	ModeIsAdmin Mode = "is_admin"
 
+	// ModeOrigin matches where the broadcast is created (webhook, scheduler, relay or api).
+	// Use parameter origin to specify the origin to match.
+	ModeOrigin Mode = "origin"
+	// ModeSourceCIDR matches the client IP of the webhook request which created the broadcast.
+	// Use parameter source_cidr to specify a list of CIDR ranges, the mode matches if the IP is in any of them.
+	// Broadcasts not created through the webhook never match.
+	// The client IP is taken from X-Forwarded-For when the request comes from a proxy gotify trusts,
+	// so it is only as reliable as the trusted proxies configured on the server.
+	ModeSourceCIDR Mode = "source_cidr"
+	// ModeUserAgent matches the User-Agent of the webhook request which created the broadcast.
+	// Use parameter user_agent to specify the User-Agent to match.
+	// Use parameter regex: true to enable regex matching.
+	ModeUserAgent Mode = "user_agent"
+
 	// ModeMessageTitle matches the message title.
 	// Use parameter message_title to specify the title to match.
 	// Use parameter regex: true to enable regex matching.
@@ -118,6 +154,16 @@ type Match struct {
 	UserID      uint   `yaml:"user_id,omitempty"`
 	IsAdmin     *bool  `yaml:"is_admin,omitempty"`
 
+	ChannelTag          string `yaml:"channel_tag,omitempty"`
+	ChannelPublic       *bool  `yaml:"channel_public,omitempty"`
+	ChannelOwnerName    string `yaml:"channel_owner_name,omitempty"`
+	ChannelOwnerID      uint   `yaml:"channel_owner_id,omitempty"`
+	ChannelOwnerIsAdmin *bool  `yaml:"channel_owner_is_admin,omitempty"`
+
+	Origin     model.Origin `yaml:"origin,omitempty"`
+	SourceCIDR []string     `yaml:"source_cidr,omitempty"`
+	UserAgent  string       `yaml:"user_agent,omitempty"`
+
 	MessageTitle    string `yaml:"message_title,omitempty"`
 	MessageText     string `yaml:"message_text,omitempty"`
 	MessageExtra    string `yaml:"message_extra,omitempty"`
@@ -141,6 +187,14 @@ func (c Match) paramFields() []string {
 		"UserName",
 		"UserID",
 		"IsAdmin",
+		"ChannelTag",
+		"ChannelPublic",
+		"ChannelOwnerName",
+		"ChannelOwnerID",
+		"ChannelOwnerIsAdmin",
+		"Origin",
+		"SourceCIDR",
+		"UserAgent",
 		"MessageTitle",
 		"MessageText",
 		"MessageExtra",
@@ -163,7 +217,37 @@ func (c Match) Check() error {
 		if c.ChannelName == "" {
 			return ErrMissingParam{c.getYAMLTagName("ChannelName")}
 		}
+		if !c.Regex {
+			if err := model.CheckChannelPattern(c.ChannelName); err != nil {
+				return err
+			}
+		}
 		c.ChannelName = ""
+	case ModeChannelTag:
+		if c.ChannelTag == "" {
+			return ErrMissingParam{c.getYAMLTagName("ChannelTag")}
+		}
+		c.ChannelTag = ""
+	case ModeChannelPublic:
+		if c.ChannelPublic == nil {
+			return ErrMissingParam{c.getYAMLTagName("ChannelPublic")}
+		}
+		c.ChannelPublic = nil
+	case ModeChannelOwnerName:
+		if c.ChannelOwnerName == "" {
+			return ErrMissingParam{c.getYAMLTagName("ChannelOwnerName")}
+		}
+		c.ChannelOwnerName = ""
+	case ModeChannelOwnerID:
+		if c.ChannelOwnerID == 0 {
+			return ErrMissingParam{c.getYAMLTagName("ChannelOwnerID")}
+		}
+		c.ChannelOwnerID = 0
+	case ModeChannelOwnerIsAdmin:
+		if c.ChannelOwnerIsAdmin == nil {
+			return ErrMissingParam{c.getYAMLTagName("ChannelOwnerIsAdmin")}
+		}
+		c.ChannelOwnerIsAdmin = nil
 	case ModeUserName:
 		if c.UserName == "" {
 			return ErrMissingParam{c.getYAMLTagName("UserName")}
@@ -179,6 +263,30 @@ func (c Match) Check() error {
 			return ErrMissingParam{c.getYAMLTagName("IsAdmin")}
 		}
 		c.IsAdmin = nil
+	case ModeOrigin:
+		switch c.Origin {
+		case "":
+			return ErrMissingParam{c.getYAMLTagName("Origin")}
+		case model.OriginWebhook, model.OriginScheduler, model.OriginRelay, model.OriginAPI:
+		default:
+			return fmt.Errorf("unsupported origin: %s", c.Origin)
+		}
+		c.Origin = ""
+	case ModeSourceCIDR:
+		if len(c.SourceCIDR) == 0 {
+			return ErrMissingParam{c.getYAMLTagName("SourceCIDR")}
+		}
+		for _, cidr := range c.SourceCIDR {
+			if _, _, err := net.ParseCIDR(cidr); err != nil {
+				return fmt.Errorf("invalid CIDR %s: %s", cidr, err.Error())
+			}
+		}
+		c.SourceCIDR = nil
+	case ModeUserAgent:
+		if c.UserAgent == "" {
+			return ErrMissingParam{c.getYAMLTagName("UserAgent")}
+		}
+		c.UserAgent = ""
 	case ModeMessageTitle:
 		if c.MessageTitle == "" {
 			return ErrMissingParam{c.getYAMLTagName("MessageTitle")}
@@ -221,7 +329,31 @@ func (c Match) Match(msg model.Message) (matched bool) {
 	case ModeAny:
 		return true
 	case ModeChannelName:
-		return stringMatch(c.Regex, c.ChannelName, msg.ChannelName)
+		if !c.Regex {
+			return model.MatchChannelName(c.ChannelName, msg.Channel.Name)
+		}
+		return stringMatch(c.Regex, c.ChannelName, msg.Channel.Name)
+	case ModeChannelTag:
+		for _, tag := range msg.Channel.Tags {
+			if stringMatch(c.Regex, c.ChannelTag, tag) {
+				return true
+			}
+		}
+		return false
+	case ModeChannelPublic:
+		if c.ChannelPublic == nil {
+			return false
+		}
+		return *c.ChannelPublic == msg.Channel.Public
+	case ModeChannelOwnerName:
+		return stringMatch(c.Regex, c.ChannelOwnerName, msg.ChannelOwner.Name)
+	case ModeChannelOwnerID:
+		return c.ChannelOwnerID == msg.ChannelOwner.ID
+	case ModeChannelOwnerIsAdmin:
+		if c.ChannelOwnerIsAdmin == nil {
+			return false
+		}
+		return *c.ChannelOwnerIsAdmin == msg.ChannelOwner.Admin
 	case ModeUserName:
 		return stringMatch(c.Regex, c.UserName, userInfo.Name)
 	case ModeUserID:
@@ -231,6 +363,12 @@ func (c Match) Match(msg model.Message) (matched bool) {
 			return false
 		}
 		return *c.IsAdmin == userInfo.Admin
+	case ModeOrigin:
+		return c.Origin == msg.Origin
+	case ModeSourceCIDR:
+		return ipInCIDRs(c.SourceCIDR, msg.SourceIP)
+	case ModeUserAgent:
+		return msg.UserAgent != "" && stringMatch(c.Regex, c.UserAgent, msg.UserAgent)
 	case ModeMessageTitle:
 		return stringMatch(c.Regex, c.MessageTitle, msg.Msg.Title)
 	case ModeMessageText:
@@ -81,8 +81,20 @@ func TestMatchMatch(t *testing.T) {
 				},
 				Priority: 5,
 			},
-			IsSend:      false,
-			ChannelName: "test_channel",
+			Channel: model.ChannelInfo{
+				Name:   "test_channel",
+				Public: true,
+				Tags:   []string{"infra", "database"},
+			},
+			ChannelOwner: plugin.UserContext{
+				ID:    3,
+				Name:  "owner",
+				Admin: true,
+			},
+			Origin:    model.OriginWebhook,
+			SourceIP:  "10.1.2.3",
+			UserAgent: "curl/7.68.0",
+			IsSend:    false,
 		}
 		c.Convey("empty rule should not panic", func(c C) {
 			c.So(func() {
@@ -109,6 +121,115 @@ func TestMatchMatch(t *testing.T) {
 				Regex:       true,
 				ChannelName: "test.channel",
 			})
+			dotted := testMessage
+			dotted.Channel.Name = "ops.db.primary"
+			c.So(dotted, shouldMatchRule, Match{
+				Mode:        ModeChannelName,
+				ChannelName: "ops.>",
+			})
+			c.So(dotted, shouldNotMatchRule, Match{
+				Mode:        ModeChannelName,
+				ChannelName: "ops.*",
+			})
+			c.So(dotted, shouldMatchRule, Match{
+				Mode:        ModeChannelName,
+				ChannelName: "ops.*.primary",
+			})
+		})
+		c.Convey("channel tag matching", func(c C) {
+			c.So(testMessage, shouldMatchRule, Match{
+				Mode:       ModeChannelTag,
+				ChannelTag: "database",
+			}, Match{
+				Mode:       ModeChannelTag,
+				Regex:      true,
+				ChannelTag: "^inf",
+			})
+			c.So(testMessage, shouldNotMatchRule, Match{
+				Mode:       ModeChannelTag,
+				ChannelTag: "data",
+			})
+		})
+		c.Convey("channel publicity matching", func(c C) {
+			isPublic := true
+			c.So(testMessage, shouldMatchRule, Match{
+				Mode:          ModeChannelPublic,
+				ChannelPublic: &isPublic,
+			})
+			isPublic = false
+			c.So(testMessage, shouldNotMatchRule, Match{
+				Mode:          ModeChannelPublic,
+				ChannelPublic: &isPublic,
+			})
+			c.So(func() {
+				rule := Match{
+					Mode: ModeChannelPublic,
+				}
+				rule.Match(testMessage)
+			}, ShouldNotPanic)
+		})
+		c.Convey("channel owner matching", func(c C) {
+			c.So(testMessage, shouldMatchRule, Match{
+				Mode:             ModeChannelOwnerName,
+				ChannelOwnerName: "owner",
+			}, Match{
+				Mode:             ModeChannelOwnerName,
+				Regex:            true,
+				ChannelOwnerName: "o...r",
+			}, Match{
+				Mode:           ModeChannelOwnerID,
+				ChannelOwnerID: 3,
+			})
+			c.So(testMessage, shouldNotMatchRule, Match{
+				Mode:             ModeChannelOwnerName,
+				ChannelOwnerName: "sender",
+			}, Match{
+				Mode:           ModeChannelOwnerID,
+				ChannelOwnerID: 1,
+			})
+			isAdmin := true
+			c.So(testMessage, shouldMatchRule, Match{
+				Mode:                ModeChannelOwnerIsAdmin,
+				ChannelOwnerIsAdmin: &isAdmin,
+			})
+			isAdmin = false
+			c.So(testMessage, shouldNotMatchRule, Match{
+				Mode:                ModeChannelOwnerIsAdmin,
+				ChannelOwnerIsAdmin: &isAdmin,
+			})
+		})
+		c.Convey("origin matching", func(c C) {
+			c.So(testMessage, shouldMatchRule, Match{
+				Mode:   ModeOrigin,
+				Origin: model.OriginWebhook,
+			})
+			c.So(testMessage, shouldNotMatchRule, Match{
+				Mode:   ModeOrigin,
+				Origin: model.OriginScheduler,
+			})
+		})
+		c.Convey("request source matching", func(c C) {
+			c.So(testMessage, shouldMatchRule, Match{
+				Mode:       ModeSourceCIDR,
+				SourceCIDR: []string{"192.168.0.0/16", "10.0.0.0/8"},
+			}, Match{
+				Mode:      ModeUserAgent,
+				Regex:     true,
+				UserAgent: "^curl/",
+			})
+			c.So(testMessage, shouldNotMatchRule, Match{
+				Mode:       ModeSourceCIDR,
+				SourceCIDR: []string{"192.168.0.0/16"},
+			}, Match{
+				Mode:      ModeUserAgent,
+				UserAgent: "curl",
+			})
+			scheduled := testMessage
+			scheduled.SourceIP = ""
+			c.So(scheduled, shouldNotMatchRule, Match{
+				Mode:       ModeSourceCIDR,
+				SourceCIDR: []string{"0.0.0.0/0"},
+			})
 		})
 		c.Convey("message matching", func(c C) {
 			c.Convey("match title", func(c C) {
@@ -280,6 +401,13 @@ func TestMatchCheck(t *testing.T) {
 				}
 				c.So(rule, shouldBeValidRule)
 			})
+			c.Convey("invalid channel pattern", func(c C) {
+				rule := Match{
+					Mode:        ModeChannelName,
+					ChannelName: "ops.>.db",
+				}
+				c.So(rule.Check(), ShouldNotBeNil)
+			})
 			c.Convey("extra field", func(c C) {
 				rule := Match{
 					Mode:        ModeUserID,
@@ -359,6 +487,119 @@ func TestMatchCheck(t *testing.T) {
 				c.So(rule, shouldBeInvalidRule, "extra")
 			})
 		})
+		c.Convey("channel public mode", func(c C) {
+			isPublic := true
+			c.Convey("missing field", func(c C) {
+				rule := Match{
+					Mode: ModeChannelPublic,
+				}
+				c.So(rule, shouldBeInvalidRule, ErrMissingParam{})
+			})
+			c.Convey("valid config", func(c C) {
+				rule := Match{
+					Mode:          ModeChannelPublic,
+					ChannelPublic: &isPublic,
+				}
+				c.So(rule, shouldBeValidRule)
+			})
+			c.Convey("extra field", func(c C) {
+				rule := Match{
+					Mode:          ModeChannelPublic,
+					UserID:        1,
+					ChannelPublic: &isPublic,
+				}
+				c.So(rule, shouldBeInvalidRule, "extra")
+			})
+		})
+		c.Convey("channel tag mode", func(c C) {
+			c.So(Match{
+				Mode: ModeChannelTag,
+			}, shouldBeInvalidRule, ErrMissingParam{})
+			c.So(Match{
+				Mode:       ModeChannelTag,
+				ChannelTag: "infra",
+			}, shouldBeValidRule)
+		})
+		c.Convey("channel owner modes", func(c C) {
+			isAdmin := true
+			c.Convey("missing field", func(c C) {
+				c.So(Match{
+					Mode: ModeChannelOwnerName,
+				}, shouldBeInvalidRule, ErrMissingParam{})
+				c.So(Match{
+					Mode: ModeChannelOwnerID,
+				}, shouldBeInvalidRule, ErrMissingParam{})
+				c.So(Match{
+					Mode: ModeChannelOwnerIsAdmin,
+				}, shouldBeInvalidRule, ErrMissingParam{})
+			})
+			c.Convey("valid config", func(c C) {
+				c.So(Match{
+					Mode:             ModeChannelOwnerName,
+					ChannelOwnerName: "owner",
+				}, shouldBeValidRule)
+				c.So(Match{
+					Mode:           ModeChannelOwnerID,
+					ChannelOwnerID: 3,
+				}, shouldBeValidRule)
+				c.So(Match{
+					Mode:                ModeChannelOwnerIsAdmin,
+					ChannelOwnerIsAdmin: &isAdmin,
+				}, shouldBeValidRule)
+			})
+			c.Convey("extra field", func(c C) {
+				c.So(Match{
+					Mode:             ModeChannelOwnerID,
+					ChannelOwnerID:   3,
+					ChannelOwnerName: "owner",
+				}, shouldBeInvalidRule, "extra")
+			})
+		})
+		c.Convey("origin mode", func(c C) {
+			c.Convey("missing field", func(c C) {
+				c.So(Match{
+					Mode: ModeOrigin,
+				}, shouldBeInvalidRule, ErrMissingParam{})
+			})
+			c.Convey("unknown origin", func(c C) {
+				c.So(Match{
+					Mode:   ModeOrigin,
+					Origin: "carrier_pigeon",
+				}, shouldBeInvalidRule, "origin")
+			})
+			c.Convey("valid config", func(c C) {
+				c.So(Match{
+					Mode:   ModeOrigin,
+					Origin: model.OriginRelay,
+				}, shouldBeValidRule)
+			})
+		})
+		c.Convey("source cidr mode", func(c C) {
+			c.Convey("missing field", func(c C) {
+				c.So(Match{
+					Mode: ModeSourceCIDR,
+				}, shouldBeInvalidRule, ErrMissingParam{})
+			})
+			c.Convey("invalid cidr", func(c C) {
+				c.So(Match{
+					Mode:       ModeSourceCIDR,
+					SourceCIDR: []string{"10.0.0.0/8", "10.0.0.1"},
+				}, shouldBeInvalidRule, "10.0.0.1")
+			})
+			c.Convey("valid config", func(c C) {
+				c.So(Match{
+					Mode:       ModeSourceCIDR,
+					SourceCIDR: []string{"10.0.0.0/8", "fd00::/8"},
+				}, shouldBeValidRule)
+			})
+			c.Convey("extra field", func(c C) {
+				c.So(Match{
+					Mode:       ModeSourceCIDR,
+					SourceCIDR: []string{"10.0.0.0/8"},
+					UserAgent:  "curl",
+				}, shouldBeInvalidRule, "extra")
+			})
+		})
 		c.Convey("message title mode", func(c C) {
 			c.Convey("missing field", func(c C) {
 				rule := Match{
@@ -1,6 +1,7 @@
 package rules
 
 import (
+	"net"
 	"regexp"
 
 	plugin "github.com/gotify/plugin-api"
@@ -24,3 +25,16 @@ func containExtra(regex bool, extra string, msg plugin.Message) bool {
 	}
 	return false
 }
+
+func ipInCIDRs(cidrs []string, ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, cidr := range cidrs {
+		if _, ipNet, err := net.ParseCIDR(cidr); err == nil && ipNet.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -26,3 +26,13 @@ func TestStringMatch(t *testing.T) {
 		})
 	})
 }
+
+func TestIPInCIDRs(t *testing.T) {
+	Convey("Test IP In CIDRs", t, func(c C) {
+		cidrs := []string{"10.0.0.0/8", "fd00::/8"}
+		c.So(ipInCIDRs(cidrs, "10.1.2.3"), ShouldBeTrue)
+		c.So(ipInCIDRs(cidrs, "fd12::1"), ShouldBeTrue)
+		c.So(ipInCIDRs(cidrs, "192.168.1.1"), ShouldBeFalse)
+		c.So(ipInCIDRs(cidrs, ""), ShouldBeFalse)
+	})
+}
@@ -27,13 +27,14 @@ func (c RuleChain) Match(msg model.Message, defaultAction Action) Action {
 }
 
 // Check checks a RuleChain for errors.
-func (c RuleChain) Check() error {
+// Actions other than Accept and Reject are only allowed when listed in extraActions.
+func (c RuleChain) Check(extraActions ...Action) error {
 	var errors []struct {
 		Index int
 		Error error
 	}
 	for index, rule := range c {
-		if rule.Action != Accept && rule.Action != Reject {
+		if rule.Action != Accept && rule.Action != Reject && !containsAction(extraActions, rule.Action) {
 			errors = append(errors, struct {
 				Index int
 				Error error
@@ -51,3 +52,12 @@ func (c RuleChain) Check() error {
 	}
 	return nil
 }
+
+func containsAction(actions []Action, action Action) bool {
+	for _, a := range actions {
+		if a == action {
+			return true
+		}
+	}
+	return false
+}
@@ -87,6 +87,20 @@ func TestChainCheck(t *testing.T) {
 
 		c.So(testChain, shouldBeInvalidChain, 0, 1)
 	})
+	Convey("Test Rule Chain Extra Actions", t, func(c C) {
+		testChain := RuleChain{
+			Rule{
+				Match: MatchSet{
+					Match{
+						Mode: ModeAny,
+					},
+				},
+				Action: Digest,
+			},
+		}
+		c.So(testChain, shouldBeInvalidChain, 0)
+		c.So(testChain.Check(Digest), ShouldBeNil)
+	})
 }
 
 func TestChainMatch(t *testing.T) {
@@ -116,8 +130,16 @@ func TestChainMatch(t *testing.T) {
 				},
 				Priority: 5,
 			},
-			IsSend:      false,
-			ChannelName: "test_channel",
+			Channel: model.ChannelInfo{
+				Name:   "test_channel",
+				Public: true,
+			},
+			ChannelOwner: plugin.UserContext{
+				ID:    3,
+				Name:  "owner",
+				Admin: true,
+			},
+			IsSend: false,
 		}
 
 		c.Convey("default action", func(c C) {
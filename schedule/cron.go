@@ -0,0 +1,154 @@
+// Package schedule implements parsing and evaluation of cron expressions.
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a parsed cron expression.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// domStar and dowStar record whether the day fields are unrestricted,
+	// a day matches either field when both are restricted.
+	domStar, dowStar bool
+}
+
+type bounds struct {
+	min, max uint
+}
+
+var (
+	minuteBounds = bounds{0, 59}
+	hourBounds   = bounds{0, 23}
+	domBounds    = bounds{1, 31}
+	monthBounds  = bounds{1, 12}
+	dowBounds    = bounds{0, 7}
+)
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse parses a standard five-field cron expression (minute, hour, day of month, month, day of week).
+// Fields support *, lists (1,2), ranges (1-5) and steps (*/15, 1-30/5).
+// The descriptors @yearly, @monthly, @weekly, @daily and @hourly are also accepted.
+func Parse(spec string) (*Schedule, error) {
+	if expanded, ok := descriptors[strings.TrimSpace(spec)]; ok {
+		spec = expanded
+	}
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("expected 5 fields in cron expression, found %d", len(fields))
+	}
+	res := new(Schedule)
+	var err error
+	for _, field := range []struct {
+		expr   string
+		bounds bounds
+		bits   *uint64
+		name   string
+	}{
+		{fields[0], minuteBounds, &res.minute, "minute"},
+		{fields[1], hourBounds, &res.hour, "hour"},
+		{fields[2], domBounds, &res.dom, "day of month"},
+		{fields[3], monthBounds, &res.month, "month"},
+		{fields[4], dowBounds, &res.dow, "day of week"},
+	} {
+		if *field.bits, err = parseField(field.expr, field.bounds); err != nil {
+			return nil, fmt.Errorf("invalid %s field: %s", field.name, err.Error())
+		}
+	}
+	// 7 is an alias of sunday
+	if res.dow&(1<<7) != 0 {
+		res.dow |= 1
+	}
+	res.domStar = fields[2] == "*" || strings.HasPrefix(fields[2], "*/")
+	res.dowStar = fields[4] == "*" || strings.HasPrefix(fields[4], "*/")
+	return res, nil
+}
+
+func parseField(expr string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		step := uint(1)
+		if idx := strings.Index(part, "/"); idx >= 0 {
+			s, err := strconv.ParseUint(part[idx+1:], 10, 8)
+			if err != nil || s == 0 {
+				return 0, fmt.Errorf("invalid step in %s", part)
+			}
+			step = uint(s)
+			part = part[:idx]
+		}
+		lo, hi := b.min, b.max
+		if part != "*" {
+			bounds := strings.SplitN(part, "-", 2)
+			v, err := strconv.ParseUint(bounds[0], 10, 8)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %s", part)
+			}
+			lo, hi = uint(v), uint(v)
+			if len(bounds) == 2 {
+				v, err := strconv.ParseUint(bounds[1], 10, 8)
+				if err != nil {
+					return 0, fmt.Errorf("invalid value %s", part)
+				}
+				hi = uint(v)
+			} else if step != 1 {
+				hi = b.max
+			}
+		}
+		if lo < b.min || hi > b.max || lo > hi {
+			return 0, fmt.Errorf("%s out of range %d-%d", part, b.min, b.max)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+func (c *Schedule) dayMatches(t time.Time) bool {
+	domMatch := c.dom&(1<<uint(t.Day())) != 0
+	dowMatch := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return domMatch && dowMatch
+	}
+	return domMatch || dowMatch
+}
+
+// Next returns the first activation time strictly after t, in the location of t.
+// The zero time is returned if the schedule never activates within the next five years.
+func (c *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		if c.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if c.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
@@ -0,0 +1,81 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func mustParse(spec string) *Schedule {
+	res, err := Parse(spec)
+	if err != nil {
+		panic(err)
+	}
+	return res
+}
+
+func TestParse(t *testing.T) {
+	Convey("Test Cron Parsing", t, func(c C) {
+		c.Convey("valid expressions", func(c C) {
+			for _, spec := range []string{
+				"* * * * *",
+				"*/15 9-17 * * 1-5",
+				"0 0 1,15 * *",
+				"30 2 * 1-12/3 7",
+				"5/10 * * * *",
+				"@daily",
+			} {
+				_, err := Parse(spec)
+				c.So(err, ShouldBeNil)
+			}
+		})
+		c.Convey("invalid expressions", func(c C) {
+			for _, spec := range []string{
+				"",
+				"* * * *",
+				"60 * * * *",
+				"* 24 * * *",
+				"* * 0 * *",
+				"* * * 13 *",
+				"* * * * 8",
+				"*/0 * * * *",
+				"5-1 * * * *",
+				"a * * * *",
+			} {
+				_, err := Parse(spec)
+				c.So(err, ShouldNotBeNil)
+			}
+		})
+	})
+}
+
+func TestNext(t *testing.T) {
+	Convey("Test Cron Next Activation", t, func(c C) {
+		base := time.Date(2020, time.January, 31, 23, 59, 30, 0, time.UTC)
+		c.Convey("every minute", func(c C) {
+			c.So(mustParse("* * * * *").Next(base), ShouldEqual, time.Date(2020, time.February, 1, 0, 0, 0, 0, time.UTC))
+		})
+		c.Convey("strictly after", func(c C) {
+			at := time.Date(2020, time.February, 1, 9, 0, 0, 0, time.UTC)
+			c.So(mustParse("0 9 * * *").Next(at), ShouldEqual, time.Date(2020, time.February, 2, 9, 0, 0, 0, time.UTC))
+		})
+		c.Convey("steps and ranges", func(c C) {
+			// 2020-02-01 is a saturday
+			c.So(mustParse("*/15 9-17 * * 1-5").Next(base), ShouldEqual, time.Date(2020, time.February, 3, 9, 0, 0, 0, time.UTC))
+		})
+		c.Convey("day of month or day of week", func(c C) {
+			c.So(mustParse("0 0 15 * 0").Next(base), ShouldEqual, time.Date(2020, time.February, 2, 0, 0, 0, 0, time.UTC))
+		})
+		c.Convey("sunday as 7", func(c C) {
+			c.So(mustParse("0 0 * * 7").Next(base), ShouldEqual, time.Date(2020, time.February, 2, 0, 0, 0, 0, time.UTC))
+		})
+		c.Convey("leap day", func(c C) {
+			c.So(mustParse("0 12 29 2 *").Next(base), ShouldEqual, time.Date(2020, time.February, 29, 12, 0, 0, 0, time.UTC))
+			c.So(mustParse("0 12 29 2 *").Next(time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC)), ShouldEqual, time.Date(2024, time.February, 29, 12, 0, 0, 0, time.UTC))
+		})
+		c.Convey("never", func(c C) {
+			c.So(mustParse("0 0 31 2 *").Next(base).IsZero(), ShouldBeTrue)
+		})
+	})
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
+	"github.com/eternal-flame-AD/gotify-broadcast/schedule"
+	"github.com/gotify/plugin-api"
+)
+
+// ScheduledBroadcast is a broadcast waiting to be sent by the scheduler
+type ScheduledBroadcast struct {
+	ID      string         `json:"id"`
+	Channel string         `json:"channel"`
+	Msg     plugin.Message `json:"message"`
+	// SendAt is the next time the broadcast is sent
+	SendAt time.Time `json:"send_at"`
+	// Cron is the schedule of a recurring broadcast, empty for one-off broadcasts
+	Cron string `json:"cron,omitempty"`
+	// TTL is how long after SendAt the broadcast may still be delivered, zero if it never expires
+	TTL     time.Duration `json:"ttl,omitempty"`
+	Created time.Time     `json:"created"`
+}
+
+// expiry returns the time after which the broadcast sent at sendAt expires, zero if it never expires
+func (c ScheduledBroadcast) expiry(sendAt time.Time) time.Time {
+	if c.TTL <= 0 {
+		return time.Time{}
+	}
+	return sendAt.Add(c.TTL)
+}
+
+// newScheduledBroadcast creates a scheduled broadcast sent at sendAt, or at the next activation of cron after sendAt
+func newScheduledBroadcast(channel string, msg plugin.Message, sendAt time.Time, cron string, ttl time.Duration) (ScheduledBroadcast, error) {
+	now := time.Now()
+	if sendAt.IsZero() {
+		sendAt = now
+	}
+	res := ScheduledBroadcast{
+		ID:      model.NewID(),
+		Channel: channel,
+		Msg:     msg,
+		SendAt:  sendAt,
+		Cron:    cron,
+		TTL:     ttl,
+		Created: now,
+	}
+	if cron != "" {
+		sched, err := schedule.Parse(cron)
+		if err != nil {
+			return res, err
+		}
+		if res.SendAt = sched.Next(sendAt.Add(-time.Minute)); res.SendAt.IsZero() {
+			return res, errors.New("cron expression never activates")
+		}
+	}
+	return res, nil
+}
+
+// advance moves a recurring broadcast to its next activation after now, it returns false if there is none
+func (c *ScheduledBroadcast) advance(now time.Time) bool {
+	if c.Cron == "" {
+		return false
+	}
+	sched, err := schedule.Parse(c.Cron)
+	if err != nil {
+		return false
+	}
+	c.SendAt = sched.Next(now)
+	return !c.SendAt.IsZero()
+}
+
+func (c *Plugin) wakeScheduler() {
+	select {
+	case c.schedulerWake <- struct{}{}:
+	default:
+	}
+}
+
+// scheduleBroadcast stores a scheduled broadcast
+func (c *Plugin) scheduleBroadcast(job ScheduledBroadcast) error {
+	err := c.storage.update(func(data *storedData) {
+		data.Scheduled = append(data.Scheduled, job)
+	})
+	c.wakeScheduler()
+	return err
+}
+
+// listScheduled lists scheduled broadcasts ordered by send time, optionally of a single channel
+func (c *Plugin) listScheduled(channel string) []ScheduledBroadcast {
+	res := make([]ScheduledBroadcast, 0)
+	c.storage.view(func(data *storedData) {
+		for _, job := range data.Scheduled {
+			if channel == "" || job.Channel == channel {
+				res = append(res, job)
+			}
+		}
+	})
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].SendAt.Before(res[j].SendAt)
+	})
+	return res
+}
+
+// cancelScheduled removes a scheduled broadcast, it returns false if the broadcast is not found
+func (c *Plugin) cancelScheduled(id string) bool {
+	found := false
+	_ = c.storage.update(func(data *storedData) {
+		res := data.Scheduled[:0]
+		for _, job := range data.Scheduled {
+			if job.ID == id {
+				found = true
+				continue
+			}
+			res = append(res, job)
+		}
+		data.Scheduled = res
+	})
+	c.wakeScheduler()
+	return found
+}
+
+// fireScheduled sends the broadcasts due at now and reschedules recurring ones
+func (c *Plugin) fireScheduled(now time.Time) {
+	type dueBroadcast struct {
+		owner     *Plugin
+		channel   ChannelDef
+		broadcast model.Message
+	}
+	var due []dueBroadcast
+	_ = c.storage.update(func(data *storedData) {
+		res := data.Scheduled[:0]
+		for _, job := range data.Scheduled {
+			if job.SendAt.After(now) {
+				res = append(res, job)
+				continue
+			}
+			// a broadcast missed while the server is down is discarded once it expires
+			if expiry := job.expiry(job.SendAt); expiry.IsZero() || !now.After(expiry) {
+				if owner, channel, err := c.resolveChannel(job.Channel); err == nil {
+					broadcast := c.newBroadcast(job.Msg, channel, model.OriginScheduler)
+					broadcast.ChannelOwner = owner.UserCtx
+					broadcast.ExpiresAt = expiry
+					due = append(due, dueBroadcast{owner, channel, broadcast})
+				}
+			}
+			if job.advance(now) {
+				res = append(res, job)
+			}
+		}
+		data.Scheduled = res
+	})
+	for _, d := range due {
+		moderated := d.channel.Moderated && d.owner != c
+		// a firing refused by the channel quota is skipped, recurring broadcasts fire again at their next time
+		if err := d.owner.enforceQuota(d.channel, d.broadcast, !moderated); err != nil {
+			continue
+		}
+		if moderated {
+			_, _ = d.owner.submitForApproval(d.channel, d.broadcast)
+			continue
+		}
+		d.owner.sendMessage(d.channel, d.broadcast)
+	}
+}
+
+// nextScheduled returns the earliest send time of the scheduled broadcasts
+func (c *Plugin) nextScheduled() (next time.Time, ok bool) {
+	c.storage.view(func(data *storedData) {
+		for _, job := range data.Scheduled {
+			if !ok || job.SendAt.Before(next) {
+				next, ok = job.SendAt, true
+			}
+		}
+	})
+	return
+}
+
+// runScheduler sends scheduled broadcasts, digests and broadcasts held during quiet hours
+// while the plugin is enabled until the instance is torn down
+func (c *Plugin) runScheduler() {
+	for {
+		var timer *time.Timer
+		var fire <-chan time.Time
+		if c.loadState().enabled {
+			var next time.Time
+			found := false
+			for _, candidate := range []func() (time.Time, bool){c.nextScheduled, c.nextDigest, c.nextRelease} {
+				if t, ok := candidate(); ok && (!found || t.Before(next)) {
+					next, found = t, true
+				}
+			}
+			if found {
+				timer = time.NewTimer(time.Until(next))
+				fire = timer.C
+			}
+		}
+		select {
+		case <-fire:
+			now := time.Now()
+			c.fireScheduled(now)
+			c.flushDigest(now)
+			c.releaseHeld(now)
+		case <-c.schedulerWake:
+		case <-c.stop:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		select {
+		case <-c.stop:
+			return
+		default:
+		}
+	}
+}
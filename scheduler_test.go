@@ -0,0 +1,112 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	plugin "github.com/gotify/plugin-api"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestScheduledBroadcast(t *testing.T) {
+	Convey("Test Scheduled Broadcast", t, func(c C) {
+		c.Convey("one-off", func(c C) {
+			sendAt := time.Now().Add(time.Hour)
+			job, err := newScheduledBroadcast("example", plugin.Message{}, sendAt, "", 0)
+			c.So(err, ShouldBeNil)
+			c.So(job.SendAt, ShouldEqual, sendAt)
+			c.So(job.advance(sendAt), ShouldBeFalse)
+		})
+		c.Convey("recurring", func(c C) {
+			start := time.Date(2020, time.January, 1, 8, 30, 0, 0, time.UTC)
+			job, err := newScheduledBroadcast("example", plugin.Message{}, start, "0 9 * * *", 0)
+			c.So(err, ShouldBeNil)
+			c.So(job.SendAt, ShouldEqual, time.Date(2020, time.January, 1, 9, 0, 0, 0, time.UTC))
+			c.So(job.advance(job.SendAt), ShouldBeTrue)
+			c.So(job.SendAt, ShouldEqual, time.Date(2020, time.January, 2, 9, 0, 0, 0, time.UTC))
+		})
+		c.Convey("expiry", func(c C) {
+			sendAt := time.Now()
+			job, _ := newScheduledBroadcast("example", plugin.Message{}, sendAt, "", 0)
+			c.So(job.expiry(sendAt).IsZero(), ShouldBeTrue)
+			job, _ = newScheduledBroadcast("example", plugin.Message{}, sendAt, "", time.Hour)
+			c.So(job.expiry(sendAt), ShouldEqual, sendAt.Add(time.Hour))
+		})
+		c.Convey("invalid cron", func(c C) {
+			_, err := newScheduledBroadcast("example", plugin.Message{}, time.Time{}, "* * *", 0)
+			c.So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestScheduler(t *testing.T) {
+	Convey("Test Scheduler", t, func(c C) {
+		store := new(memoryStorage)
+		userCtx := plugin.UserContext{ID: nextTestUserID(), Name: "scheduler"}
+		newInstance := func() (*Plugin, recordingHandler) {
+			p := NewGotifyPluginInstance(userCtx).(*Plugin)
+			handler := make(recordingHandler, 10)
+			p.SetStorageHandler(store)
+			p.SetMessageHandler(handler)
+			c.So(p.ValidateAndSetConfig(p.DefaultConfig()), ShouldBeNil)
+			return p, handler
+		}
+		defer removeTestUser(userCtx.ID)
+
+		p, _ := newInstance()
+		job, err := newScheduledBroadcast("example", plugin.Message{Title: "later"}, time.Now().Add(200*time.Millisecond), "", 0)
+		c.So(err, ShouldBeNil)
+		c.So(p.scheduleBroadcast(job), ShouldBeNil)
+		cancelled, _ := newScheduledBroadcast("example", plugin.Message{Title: "cancelled"}, time.Now().Add(100*time.Millisecond), "", 0)
+		c.So(p.scheduleBroadcast(cancelled), ShouldBeNil)
+		c.So(p.listScheduled("example"), ShouldHaveLength, 2)
+		c.So(p.listScheduled("other"), ShouldBeEmpty)
+		c.So(p.cancelScheduled(cancelled.ID), ShouldBeTrue)
+		c.So(p.cancelScheduled(cancelled.ID), ShouldBeFalse)
+
+		// restart before the broadcast is due
+		p, handler := newInstance()
+		c.So(p.listScheduled(""), ShouldHaveLength, 1)
+		c.So(p.Enable(), ShouldBeNil)
+		select {
+		case msg := <-handler:
+			c.So(msg.Title, ShouldEqual, "later")
+		case <-time.After(2 * time.Second):
+			t.Fatal("timeout")
+		}
+		c.So(p.listScheduled(""), ShouldBeEmpty)
+	})
+}
+
+func TestSchedulerDiscardsExpired(t *testing.T) {
+	Convey("Test Scheduler Discards Expired Broadcasts", t, func(c C) {
+		userCtx := plugin.UserContext{ID: nextTestUserID(), Name: "scheduler_ttl"}
+		p := NewGotifyPluginInstance(userCtx).(*Plugin)
+		defer removeTestUser(userCtx.ID)
+		handler := make(recordingHandler, 10)
+		p.SetMessageHandler(handler)
+		c.So(p.ValidateAndSetConfig(p.DefaultConfig()), ShouldBeNil)
+		c.So(p.Enable(), ShouldBeNil)
+
+		now := time.Now()
+		missed, _ := newScheduledBroadcast("example", plugin.Message{Title: "missed"}, now.Add(-2*time.Hour), "", time.Hour)
+		late, _ := newScheduledBroadcast("example", plugin.Message{Title: "late"}, now.Add(-30*time.Minute), "", time.Hour)
+		_ = p.storage.update(func(data *storedData) {
+			data.Scheduled = append(data.Scheduled, missed, late)
+		})
+		p.fireScheduled(now)
+		select {
+		case msg := <-handler:
+			c.So(msg.Title, ShouldEqual, "late")
+		case <-time.After(1 * time.Second):
+			t.Fatal("timeout")
+		}
+		select {
+		case msg := <-handler:
+			t.Errorf("expired broadcast %s delivered", msg.Title)
+		case <-time.After(100 * time.Millisecond):
+		}
+		c.So(p.listScheduled(""), ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
+)
+
+var (
+	errChannelNotFound = errors.New("channel not found")
+	errNotPoster       = errors.New("not allowed to post to this channel")
+)
+
+// checkMembers checks the members of a channel for errors
+func checkMembers(channel ChannelDef) error {
+	seen := make(map[string]struct{})
+	for _, member := range channel.Members {
+		if member.User == "" {
+			return fmt.Errorf("member of channel %s has no user name", channel.Name)
+		}
+		if _, ok := seen[member.User]; ok {
+			return fmt.Errorf("member %s of channel %s is duplicated", member.User, channel.Name)
+		}
+		seen[member.User] = struct{}{}
+		switch member.Role {
+		case model.RolePoster, model.RoleSubscriber:
+		default:
+			return fmt.Errorf("unsupported role %s of member %s in channel %s", member.Role, member.User, channel.Name)
+		}
+	}
+	return nil
+}
+
+// resolveChannel finds the channel to post to, given either as a channel of the user or as owner/channel,
+// and returns the plugin instance of its owner
+func (c *Plugin) resolveChannel(ref string) (owner *Plugin, channel ChannelDef, err error) {
+	i := strings.LastIndex(ref, "/")
+	if i < 0 || ref[:i] == c.UserCtx.Name {
+		channel, ok := c.getChannel(ref[i+1:])
+		if !ok {
+			return nil, ChannelDef{}, errChannelNotFound
+		}
+		return c, channel, nil
+	}
+	ownerCtx, ok := usersList.GetUserByName(ref[:i])
+	if !ok {
+		return nil, ChannelDef{}, errChannelNotFound
+	}
+	if owner = usersList.GetInstance(ownerCtx.ID); owner == nil {
+		return nil, ChannelDef{}, errChannelNotFound
+	}
+	if channel, ok = owner.getChannel(ref[i+1:]); !ok {
+		return nil, ChannelDef{}, errChannelNotFound
+	}
+	// anyone may propose broadcasts to a moderated channel as the owner approves each of them,
+	// unless the channel is only for its members
+	role := channel.RoleOf(c.UserCtx.Name)
+	if channel.Moderated && channel.MembersOnly && role == "" {
+		return nil, ChannelDef{}, errNotPoster
+	}
+	if !channel.Moderated && role != model.RolePoster {
+		return nil, ChannelDef{}, errNotPoster
+	}
+	return owner, channel, nil
+}
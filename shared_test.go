@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSharedChannels(t *testing.T) {
+	Convey("Test Shared Channels", t, func(c C) {
+		newTestUser(c, "alice", func(config *Config) {
+			config.Channels = []ChannelDef{{Name: "alerts", Members: []model.ChannelMember{
+				{User: "bob", Role: model.RolePoster},
+				{User: "carol", Role: model.RoleSubscriber},
+			}}}
+		})
+		bob, _ := newTestUser(c, "bob", nil)
+		carol, carolHandler := newTestUser(c, "carol", func(config *Config) {
+			config.ReceiveMode = ReceiveSubscribed
+		})
+
+		c.Convey("poster", func(c C) {
+			w := postJSON(newTestWebhook(bob), "/message?channel=alice/alerts", `{"message": "hello"}`, nil)
+			c.So(w.Code, ShouldEqual, http.StatusOK)
+			select {
+			case msg := <-carolHandler:
+				c.So(msg.Message, ShouldContainSubstring, "Sender: bob")
+				c.So(msg.Message, ShouldContainSubstring, "Channel: alerts (owned by alice)")
+			case <-time.After(time.Second):
+				c.So("broadcast not delivered", ShouldBeEmpty)
+			}
+		})
+		c.Convey("subscriber", func(c C) {
+			c.So(postJSON(newTestWebhook(carol), "/message?channel=alice/alerts", `{"message": "hello"}`, nil).Code, ShouldEqual, http.StatusForbidden)
+		})
+		c.Convey("unknown channel", func(c C) {
+			c.So(postJSON(newTestWebhook(bob), "/message?channel=alice/news", `{"message": "hello"}`, nil).Code, ShouldEqual, http.StatusBadRequest)
+			c.So(postJSON(newTestWebhook(bob), "/message?channel=nobody/alerts", `{"message": "hello"}`, nil).Code, ShouldEqual, http.StatusBadRequest)
+		})
+		c.Convey("members", func(c C) {
+			c.So(checkMembers(ChannelDef{Members: []model.ChannelMember{{User: "bob", Role: "admin"}}}), ShouldNotBeNil)
+			c.So(checkMembers(ChannelDef{Members: []model.ChannelMember{{Role: model.RolePoster}}}), ShouldNotBeNil)
+			c.So(checkMembers(ChannelDef{Members: []model.ChannelMember{{User: "bob", Role: model.RolePoster}, {User: "bob", Role: model.RoleSubscriber}}}), ShouldNotBeNil)
+		})
+	})
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
+	"github.com/gotify/plugin-api"
+)
+
+// storedData is the data persisted through the plugin storage API
+type storedData struct {
+	OfflineQueue []model.Message      `json:"offline_queue,omitempty"`
+	Scheduled    []ScheduledBroadcast `json:"scheduled,omitempty"`
+	Digest       []model.Message      `json:"digest,omitempty"`
+	DigestSentAt time.Time            `json:"digest_sent_at,omitempty"`
+	Held         []model.Message      `json:"held,omitempty"`
+	Invites      []Invite             `json:"invites,omitempty"`
+	Joined       []ChannelMembership  `json:"joined,omitempty"`
+	Pending      []PendingBroadcast   `json:"pending,omitempty"`
+}
+
+// pluginStorage is a thread-safe wrapper around the plugin storage handler
+type pluginStorage struct {
+	mutex   sync.Mutex
+	handler plugin.StorageHandler
+	data    storedData
+}
+
+func (c *pluginStorage) setHandler(h plugin.StorageHandler) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.handler = h
+	b, err := h.Load()
+	if err != nil || len(b) == 0 {
+		return err
+	}
+	return json.Unmarshal(b, &c.data)
+}
+
+// view calls read with the stored data without persisting it
+func (c *pluginStorage) view(read func(data *storedData)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	read(&c.data)
+}
+
+// update applies a change to the stored data and persists it
+func (c *pluginStorage) update(change func(data *storedData)) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	change(&c.data)
+	if c.handler == nil {
+		return nil
+	}
+	b, err := json.Marshal(c.data)
+	if err != nil {
+		return err
+	}
+	return c.handler.Save(b)
+}
+
+// SetStorageHandler implements plugin.Storager
+func (c *Plugin) SetStorageHandler(h plugin.StorageHandler) {
+	_ = c.storage.setHandler(h)
+	c.wakeScheduler()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
+	plugin "github.com/gotify/plugin-api"
+)
+
+const (
+	// ReceiveAll receives every broadcast unless it is rejected by the sender filter.
+	ReceiveAll ReceiveMode = "all"
+	// ReceiveSubscribed receives only broadcasts sent through subscribed channels.
+	ReceiveSubscribed ReceiveMode = "subscribed"
+)
+
+// ReceiveMode chooses which broadcasts a user receives
+type ReceiveMode string
+
+// checkSubscriptions checks the receive mode and that every subscription is in the form owner/channel,
+// where channel may contain wildcards
+func checkSubscriptions(mode ReceiveMode, subscriptions []string) error {
+	switch mode {
+	case "", ReceiveAll, ReceiveSubscribed:
+	default:
+		return fmt.Errorf("unsupported receive mode: %s", mode)
+	}
+	for _, sub := range subscriptions {
+		i := strings.LastIndex(sub, "/")
+		if i <= 0 || i == len(sub)-1 {
+			return fmt.Errorf("subscription %s is not in the form owner/channel", sub)
+		}
+		if err := model.CheckChannelPattern(sub[i+1:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subscriptionMatches reports whether a subscription owner/pattern covers the channel of owner
+func subscriptionMatches(sub string, owner plugin.UserContext, channel string) bool {
+	i := strings.LastIndex(sub, "/")
+	return i > 0 && sub[:i] == owner.Name && model.MatchChannelName(sub[i+1:], channel)
+}
+
+// isSubscribed reports whether the user receives broadcasts sent through the channel of msg
+func (c *Config) isSubscribed(msg model.Message) bool {
+	if c.ReceiveMode != ReceiveSubscribed {
+		return true
+	}
+	if msg.ReceiverRole != "" {
+		return true
+	}
+	for _, sub := range c.Subscriptions {
+		if subscriptionMatches(sub, msg.ChannelOwner, msg.Channel.Name) {
+			return true
+		}
+	}
+	return false
+}
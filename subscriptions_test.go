@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
+	plugin "github.com/gotify/plugin-api"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestSubscriptions(t *testing.T) {
+	Convey("Test Subscriptions", t, func(c C) {
+		c.Convey("check", func(c C) {
+			c.So(checkSubscriptions("", nil), ShouldBeNil)
+			c.So(checkSubscriptions(ReceiveSubscribed, []string{"alice/alerts"}), ShouldBeNil)
+			c.So(checkSubscriptions("some", nil), ShouldNotBeNil)
+			c.So(checkSubscriptions(ReceiveSubscribed, []string{"alice/ops.>"}), ShouldBeNil)
+			for _, sub := range []string{"alerts", "/alerts", "alice/", "alice/ops.>.db"} {
+				c.So(checkSubscriptions(ReceiveAll, []string{sub}), ShouldNotBeNil)
+			}
+		})
+		c.Convey("screening", func(c C) {
+			p := &Plugin{UserCtx: plugin.UserContext{ID: 11001, Name: "subscriber"}}
+			config := p.DefaultConfig().(*Config)
+			config.Subscriptions = []string{"alice/alerts", "alice/ops.*"}
+			c.So(p.ValidateAndSetConfig(config), ShouldBeNil)
+			c.So(p.Enable(), ShouldBeNil)
+			defer publicChannels.UpdateSubscriptionsForUser(p.UserCtx, nil)
+
+			alice := plugin.UserContext{ID: 1, Name: "alice"}
+			subscribed := model.Message{ChannelOwner: alice, Channel: ChannelInfo{Name: "alerts"}}
+			other := model.Message{ChannelOwner: alice, Channel: ChannelInfo{Name: "news"}}
+			c.So(p.screenMessage(other), ShouldEqual, StatusDelivered)
+
+			config.ReceiveMode = ReceiveSubscribed
+			c.So(p.ValidateAndSetConfig(config), ShouldBeNil)
+			c.So(p.screenMessage(subscribed), ShouldEqual, StatusDelivered)
+			c.So(p.screenMessage(other), ShouldEqual, StatusNotSubscribed)
+			c.So(p.screenMessage(model.Message{ChannelOwner: alice, Channel: ChannelInfo{Name: "ops.db"}}), ShouldEqual, StatusDelivered)
+			c.So(p.screenMessage(model.Message{ChannelOwner: alice, Channel: ChannelInfo{Name: "ops.db.primary"}}), ShouldEqual, StatusNotSubscribed)
+		})
+	})
+}
@@ -0,0 +1,367 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
+	plugin "github.com/gotify/plugin-api"
+)
+
+const (
+	templateTimeout   = time.Second
+	templateMaxOutput = 64 << 10
+	// templateMaxRangeDepth is how deep ranges may be nested in a template
+	templateMaxRangeDepth = 2
+	// templateMaxRangeIterations is how many elements the ranges of a template may visit in one execution
+	templateMaxRangeIterations = 10000
+	// maxCachedTemplates is how many parsed templates are kept before the cache is cleared
+	maxCachedTemplates = 256
+)
+
+var (
+	errTemplateTimeout   = errors.New("template execution timed out")
+	errTemplateTooLarge  = errors.New("template output is too large")
+	errTemplateTooLong   = errors.New("template ranges over too many elements")
+	markdownEscaper      = strings.NewReplacer(`\`, `\\`, "`", "\\`", "*", `\*`, "_", `\_`, "{", `\{`, "}", `\}`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`, "#", `\#`, "+", `\+`, "-", `\-`, ".", `\.`, "!", `\!`, "|", `\|`, "<", `\<`, ">", `\>`)
+	parsedTemplates      templateCache
+	sampleTemplateSource = model.Message{
+		Sender:    plugin.UserContext{ID: 1, Name: "sender"},
+		Receiver:  plugin.UserContext{ID: 2, Name: "receiver"},
+		Msg:       plugin.Message{Title: "title", Message: "message", Priority: 5},
+		Channel:   ChannelInfo{Name: "channel"},
+		Timestamp: time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC),
+	}
+)
+
+// rangeIterationAction calls rangeIteration, it is added to the start of every range in a message template
+// so that executions ranging over too many elements stop instead of running on after the timeout
+var rangeIterationAction = template.Must(template.New("").Funcs(template.FuncMap{
+	"rangeIteration": func() string { return "" },
+}).Parse("{{rangeIteration}}")).Root.Nodes[0]
+
+// templateFuncs are the helper functions available in message templates
+var templateFuncs = template.FuncMap{
+	// truncate shortens s to at most n characters, marking the cut with an ellipsis
+	"truncate": func(n int, s string) string {
+		r := []rune(s)
+		if len(r) <= n {
+			return s
+		}
+		if n <= 0 {
+			return ""
+		}
+		return string(r[:n-1]) + "…"
+	},
+	"escapeMarkdown": markdownEscaper.Replace,
+	"formatTime": func(layout string, t time.Time) string {
+		return t.Format(layout)
+	},
+}
+
+// TemplateConfig overrides how broadcasts are rendered, empty templates keep the default
+type TemplateConfig struct {
+	Title string `yaml:"title,omitempty"`
+	Body  string `yaml:"body,omitempty"`
+}
+
+// Check parses the templates and executes them with a sample broadcast
+func (c TemplateConfig) Check() error {
+	for _, text := range []string{c.Title, c.Body} {
+		if text == "" {
+			continue
+		}
+		if _, err := renderTemplate(text, sampleTemplateSource); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// templateCache holds parsed and checked templates by the type of the data they are executed with and their text
+type templateCache struct {
+	mutex   sync.Mutex
+	entries map[string]*template.Template
+}
+
+func parseTemplate(text string, data reflect.Type) (*template.Template, error) {
+	key := fmt.Sprintf("%v\x00%s", data, text)
+	parsedTemplates.mutex.Lock()
+	tmpl, ok := parsedTemplates.entries[key]
+	parsedTemplates.mutex.Unlock()
+	if ok {
+		return tmpl, nil
+	}
+	tmpl, err := template.New("message").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTemplate(tmpl, data); err != nil {
+		return nil, err
+	}
+	countRangeIterations(tmpl.Root)
+	parsedTemplates.mutex.Lock()
+	if parsedTemplates.entries == nil || len(parsedTemplates.entries) >= maxCachedTemplates {
+		parsedTemplates.entries = make(map[string]*template.Template)
+	}
+	parsedTemplates.entries[key] = tmpl
+	parsedTemplates.mutex.Unlock()
+	return tmpl, nil
+}
+
+// checkTemplate rejects templates which may run for long regardless of the size of the data they are executed with.
+// Executing a template cannot be cancelled, so ranges are only allowed over fields of the data holding a slice, array or map
+// and may only be nested templateMaxRangeDepth deep, and templates may not define or invoke other templates.
+func checkTemplate(tmpl *template.Template, data reflect.Type) error {
+	if len(tmpl.Templates()) > 1 {
+		return errors.New("templates may not define other templates")
+	}
+	if tmpl.Tree == nil {
+		return nil
+	}
+	return checkTemplateNode(tmpl.Root, data, data, 0)
+}
+
+func checkTemplateNode(node parse.Node, root reflect.Type, dot reflect.Type, depth int) error {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return nil
+		}
+		for _, n := range node.Nodes {
+			if err := checkTemplateNode(n, root, dot, depth); err != nil {
+				return err
+			}
+		}
+	case *parse.IfNode:
+		if err := checkTemplateNode(node.List, root, dot, depth); err != nil {
+			return err
+		}
+		return checkTemplateNode(node.ElseList, root, dot, depth)
+	case *parse.WithNode:
+		if err := checkTemplateNode(node.List, root, pipeType(node.Pipe, root, dot), depth); err != nil {
+			return err
+		}
+		return checkTemplateNode(node.ElseList, root, dot, depth)
+	case *parse.RangeNode:
+		if depth >= templateMaxRangeDepth {
+			return fmt.Errorf("ranges may not be nested more than %d deep", templateMaxRangeDepth)
+		}
+		t := pipeType(node.Pipe, root, dot)
+		if t == nil || (t.Kind() != reflect.Slice && t.Kind() != reflect.Array && t.Kind() != reflect.Map) {
+			return fmt.Errorf("range over %s is not allowed, only fields holding a list or map may be ranged over", node.Pipe)
+		}
+		if err := checkTemplateNode(node.List, root, t.Elem(), depth+1); err != nil {
+			return err
+		}
+		return checkTemplateNode(node.ElseList, root, dot, depth)
+	case *parse.TemplateNode:
+		return errors.New("templates may not invoke other templates")
+	}
+	return nil
+}
+
+// countRangeIterations adds rangeIterationAction to every range below node
+func countRangeIterations(node parse.Node) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, n := range node.Nodes {
+			countRangeIterations(n)
+		}
+	case *parse.IfNode:
+		countRangeIterations(node.List)
+		countRangeIterations(node.ElseList)
+	case *parse.WithNode:
+		countRangeIterations(node.List)
+		countRangeIterations(node.ElseList)
+	case *parse.RangeNode:
+		countRangeIterations(node.List)
+		countRangeIterations(node.ElseList)
+		node.List.Nodes = append([]parse.Node{rangeIterationAction}, node.List.Nodes...)
+	}
+}
+
+// pipeType returns the type of a pipeline consisting of a single field or dot, nil if it is not known without executing it
+func pipeType(pipe *parse.PipeNode, root reflect.Type, dot reflect.Type) reflect.Type {
+	if pipe == nil || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return nil
+	}
+	switch arg := pipe.Cmds[0].Args[0].(type) {
+	case *parse.DotNode:
+		return fieldType(dot, nil)
+	case *parse.FieldNode:
+		return fieldType(dot, arg.Ident)
+	case *parse.VariableNode:
+		if arg.Ident[0] == "$" {
+			return fieldType(root, arg.Ident[1:])
+		}
+	}
+	return nil
+}
+
+// fieldType returns the type of the field chain names of t, nil if it is not known without executing the template
+func fieldType(t reflect.Type, names []string) reflect.Type {
+	for _, name := range names {
+		if t == nil {
+			return nil
+		}
+		if method, ok := t.MethodByName(name); ok {
+			if method.Type.NumOut() == 0 {
+				return nil
+			}
+			t = method.Type.Out(0)
+			continue
+		}
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+		switch t.Kind() {
+		case reflect.Struct:
+			field, ok := t.FieldByName(name)
+			if !ok {
+				return nil
+			}
+			t = field.Type
+		case reflect.Map:
+			t = t.Elem()
+		default:
+			return nil
+		}
+	}
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t != nil && t.Kind() == reflect.Interface {
+		return nil
+	}
+	return t
+}
+
+// limitedBuffer fails writes beyond its limit, which aborts template execution
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (c *limitedBuffer) Write(p []byte) (int, error) {
+	if c.Len()+len(p) > c.limit {
+		return 0, errTemplateTooLarge
+	}
+	return c.Buffer.Write(p)
+}
+
+// executeTemplate executes a template parsed by parseTemplate, failing once its ranges visit templateMaxRangeIterations elements
+func executeTemplate(tmpl *template.Template, w io.Writer, data interface{}) error {
+	// the parsed template is shared, so the iteration counter is bound to a copy of it
+	tmpl, err := tmpl.Clone()
+	if err != nil {
+		return err
+	}
+	iterations := 0
+	tmpl.Funcs(template.FuncMap{
+		"rangeIteration": func() (string, error) {
+			if iterations++; iterations > templateMaxRangeIterations {
+				return "", errTemplateTooLong
+			}
+			return "", nil
+		},
+	})
+	return tmpl.Execute(w, data)
+}
+
+// renderTemplate executes a template with a timeout and an output size limit
+func renderTemplate(text string, data interface{}) (string, error) {
+	tmpl, err := parseTemplate(text, reflect.TypeOf(data))
+	if err != nil {
+		return "", err
+	}
+	type result struct {
+		out string
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		buf := &limitedBuffer{limit: templateMaxOutput}
+		err := executeTemplate(tmpl, buf, data)
+		done <- result{buf.String(), err}
+	}()
+	select {
+	case res := <-done:
+		return res.out, res.err
+	case <-time.After(templateTimeout):
+		return "", errTemplateTimeout
+	}
+}
+
+// channelTemplates returns the templates of a channel
+func channelTemplates(channel ChannelDef) TemplateConfig {
+	return TemplateConfig{Title: channel.TitleTemplate, Body: channel.BodyTemplate}
+}
+
+// broadcastTemplates returns the templates of the channel a broadcast is sent through as its owner configures them now,
+// since a broadcast only carries the public part of its channel
+func broadcastTemplates(msg model.Message) TemplateConfig {
+	if owner := usersList.GetInstance(msg.ChannelOwner.ID); owner != nil {
+		if channel, ok := owner.getChannel(msg.Channel.Name); ok {
+			return channelTemplates(channel)
+		}
+	}
+	return TemplateConfig{}
+}
+
+// apply renders the title and body of a broadcast with the templates, keeping the original on errors
+func (c TemplateConfig) apply(msg model.Message) model.Message {
+	res := msg
+	if c.Title != "" {
+		if title, err := renderTemplate(c.Title, msg); err == nil {
+			res.Msg.Title = title
+		}
+	}
+	if c.Body != "" {
+		if body, err := renderTemplate(c.Body, msg); err == nil {
+			res.Msg.Message = body
+		}
+	}
+	return res
+}
+
+// render renders a broadcast for delivery, first with the templates of its channel and then with the templates of the receiver
+func render(config *Config, msg model.Message) plugin.Message {
+	meta := broadcastMeta(msg)
+	msg = broadcastTemplates(msg).apply(msg)
+	if config.ForceMarkdown && !isMarkdown(msg.Msg) {
+		msg.Msg.Extras = withMarkdown(msg.Msg.Extras)
+	}
+	wrapper := config.Template
+	if wrapper.Body == "" && !config.HideFooter {
+		tmpl := msgTemplate
+		if isMarkdown(msg.Msg) {
+			tmpl = markdownMsgTemplate
+		}
+		wrapped := bytes.NewBuffer([]byte{})
+		if err := tmpl.Execute(wrapped, msg); err == nil {
+			msg.Msg.Message = wrapped.String()
+		}
+	}
+	res := wrapper.apply(msg).Msg
+	res.Extras = withExtra(res.Extras, broadcastMetaKey, meta)
+	return res
+}
+
+func checkChannelTemplates(channel ChannelDef) error {
+	if err := channelTemplates(channel).Check(); err != nil {
+		return fmt.Errorf("template of channel %s: %v", channel.Name, err)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
+	plugin "github.com/gotify/plugin-api"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func TestTemplates(t *testing.T) {
+	Convey("Test Templates", t, func(c C) {
+		c.Convey("helpers", func(c C) {
+			out, err := renderTemplate(`{{truncate 5 .}}|{{truncate 10 .}}`, "hello world")
+			c.So(err, ShouldBeNil)
+			c.So(out, ShouldEqual, "hell…|hello wor…")
+			out, err = renderTemplate(`{{escapeMarkdown .}}`, "*bold* [link](url)")
+			c.So(err, ShouldBeNil)
+			c.So(out, ShouldEqual, `\*bold\* \[link\]\(url\)`)
+			out, err = renderTemplate(`{{formatTime "2006-01-02 15:04" .}}`, time.Date(2020, time.March, 4, 5, 6, 0, 0, time.UTC))
+			c.So(err, ShouldBeNil)
+			c.So(out, ShouldEqual, "2020-03-04 05:06")
+		})
+		c.Convey("limits output", func(c C) {
+			big := make([]string, 128)
+			for i := range big {
+				big[i] = strings.Repeat("x", 1024)
+			}
+			_, err := renderTemplate(`{{range .}}{{.}}{{end}}`, big)
+			c.So(err, ShouldNotBeNil)
+			c.So(err.Error(), ShouldContainSubstring, errTemplateTooLarge.Error())
+		})
+		c.Convey("bounds the parsed templates", func(c C) {
+			for i := 0; i <= maxCachedTemplates; i++ {
+				_, err := renderTemplate(fmt.Sprintf("%d", i), nil)
+				c.So(err, ShouldBeNil)
+			}
+			parsedTemplates.mutex.Lock()
+			c.So(len(parsedTemplates.entries), ShouldBeLessThanOrEqualTo, maxCachedTemplates)
+			parsedTemplates.mutex.Unlock()
+		})
+		c.Convey("limits range iterations", func(c C) {
+			extras := make(map[string]interface{})
+			for i := 0; i < 200; i++ {
+				extras[fmt.Sprintf("key%d", i)] = i
+			}
+			msg := model.Message{Msg: plugin.Message{Extras: extras}}
+			start := time.Now()
+			_, err := renderTemplate(`{{range .Msg.Extras}}{{range $.Msg.Extras}}{{end}}{{end}}`, msg)
+			c.So(err, ShouldNotBeNil)
+			c.So(err.Error(), ShouldContainSubstring, errTemplateTooLong.Error())
+			c.So(time.Since(start), ShouldBeLessThan, templateTimeout)
+
+			out, err := renderTemplate(`{{range .Msg.Extras}}x{{end}}`, msg)
+			c.So(err, ShouldBeNil)
+			c.So(out, ShouldHaveLength, 200)
+		})
+		c.Convey("validation", func(c C) {
+			c.So(TemplateConfig{Body: "{{.Msg.Message}}"}.Check(), ShouldBeNil)
+			c.So(TemplateConfig{Body: "{{.Msg.Message"}.Check(), ShouldNotBeNil)
+			c.So(TemplateConfig{Title: "{{.NoSuchField}}"}.Check(), ShouldNotBeNil)
+			c.So(checkChannelTemplates(ChannelDef{Name: "ch", BodyTemplate: "{{unknownFunc}}"}), ShouldNotBeNil)
+
+			c.So(TemplateConfig{Body: "{{range .Channel.Tags}}{{range $.Channel.Tags}}{{.}}{{end}}{{end}}"}.Check(), ShouldBeNil)
+			c.So(TemplateConfig{Body: "{{range 2000000000}}{{end}}"}.Check(), ShouldNotBeNil)
+			c.So(TemplateConfig{Body: "{{.Channel.Members}}"}.Check(), ShouldNotBeNil)
+			c.So(TemplateConfig{Body: "{{range .Msg.Priority}}{{end}}"}.Check(), ShouldNotBeNil)
+			c.So(TemplateConfig{Body: "{{range .Msg.Extras}}{{range .}}{{end}}{{end}}"}.Check(), ShouldNotBeNil)
+			c.So(TemplateConfig{Body: "{{range .Channel.Tags}}{{range $.Channel.Tags}}{{range $.Channel.Tags}}{{end}}{{end}}{{end}}"}.Check(), ShouldNotBeNil)
+			c.So(TemplateConfig{Body: `{{define "loop"}}{{template "loop"}}{{end}}{{template "loop"}}`}.Check(), ShouldNotBeNil)
+			c.So(TemplateConfig{Body: `{{template "missing"}}`}.Check(), ShouldNotBeNil)
+			c.So(DigestConfig{Template: "{{range .Groups}}{{range .Messages}}{{.Msg.Title}}{{end}}{{end}}"}.Check(), ShouldBeNil)
+			c.So(DigestConfig{Template: "{{range .Count}}{{end}}"}.Check(), ShouldNotBeNil)
+
+			p := &Plugin{UserCtx: plugin.UserContext{ID: 16001, Name: "templates"}}
+			config := p.DefaultConfig().(*Config)
+			config.Template.Title = "{{"
+			c.So(p.ValidateAndSetConfig(config), ShouldNotBeNil)
+		})
+		c.Convey("rendering", func(c C) {
+			alice, _ := newTestUser(c, "alice", func(config *Config) {
+				config.Channels = []ChannelDef{
+					{Name: "alerts", TitleTemplate: "{{.Channel.Name}}: {{.Msg.Title}}", BodyTemplate: "{{.Msg.Message}} (from {{.Sender.Name}})"},
+					{Name: "ops_db"},
+				}
+			})
+			msg := model.Message{
+				Sender:       alice.UserCtx,
+				ChannelOwner: alice.UserCtx,
+				Msg:          plugin.Message{Title: "disk full", Message: "90% used on /var"},
+				Channel:      ChannelInfo{Name: "alerts"},
+			}
+			rendered := render(new(Config), msg)
+			c.So(rendered.Title, ShouldEqual, "alerts: disk full")
+			c.So(rendered.Message, ShouldStartWith, "\n90% used on /var (from alice)")
+			c.So(rendered.Message, ShouldContainSubstring, "Sent with gotify-broadcast plugin.")
+
+			compact := &Config{Template: TemplateConfig{Title: "[{{.Sender.Name}}] {{.Msg.Title}}", Body: "{{.Msg.Message}}"}}
+			rendered = render(compact, msg)
+			c.So(rendered.Title, ShouldEqual, "[alice] alerts: disk full")
+			c.So(rendered.Message, ShouldEqual, "90% used on /var (from alice)")
+			c.So(strings.Contains(rendered.Message, "Sent with"), ShouldBeFalse)
+
+			c.Convey("markdown", func(c C) {
+				markdown := msg
+				markdown.Channel = ChannelInfo{Name: "ops_db"}
+				markdown.Msg.Extras = map[string]interface{}{
+					"client::display": map[string]interface{}{"contentType": "text/markdown"},
+				}
+				rendered := render(new(Config), markdown)
+				c.So(rendered.Message, ShouldStartWith, "90% used on /var\n\n---\n")
+				c.So(rendered.Message, ShouldContainSubstring, "| alice | ops\\_db | 0 |")
+				c.So(rendered.Message, ShouldNotContainSubstring, "==============")
+
+				plain := render(new(Config), msg)
+				c.So(plain.Message, ShouldContainSubstring, "==============")
+				c.So(isMarkdown(plain), ShouldBeFalse)
+
+				forced := render(&Config{ForceMarkdown: true}, msg)
+				c.So(forced.Message, ShouldContainSubstring, "| --- | --- | --- |")
+				c.So(isMarkdown(forced), ShouldBeTrue)
+				c.So(msg.Msg.Extras, ShouldBeNil)
+			})
+
+			c.Convey("metadata", func(c C) {
+				withExtras := msg
+				withExtras.ID = "0123"
+				withExtras.Msg.Extras = map[string]interface{}{
+					"custom::key":    "value",
+					broadcastMetaKey: "spoofed",
+				}
+				rendered := render(compact, withExtras)
+				c.So(rendered.Extras["custom::key"], ShouldEqual, "value")
+				meta := rendered.Extras[broadcastMetaKey].(map[string]interface{})
+				c.So(meta["id"], ShouldEqual, "0123")
+				c.So(meta["sender_name"], ShouldEqual, "alice")
+				c.So(meta["channel"], ShouldEqual, "alerts")
+				c.So(meta["title"], ShouldEqual, "disk full")
+				c.So(withExtras.Msg.Extras[broadcastMetaKey], ShouldEqual, "spoofed")
+
+				hidden := render(&Config{HideFooter: true}, msg)
+				c.So(hidden.Message, ShouldEqual, "90% used on /var (from alice)")
+				c.So(hidden.Extras, ShouldContainKey, broadcastMetaKey)
+			})
+
+			broken := TemplateConfig{Body: "{{truncate .Msg.Message}}"}.apply(msg)
+			c.So(broken.Msg.Message, ShouldEqual, "90% used on /var")
+		})
+	})
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"sort"
 	"sync"
 
 	"github.com/gotify/plugin-api"
@@ -8,26 +9,81 @@ import (
 
 var usersList = new(UserPool)
 
-// UserPool is thread-safe user pool
+// UserPool is thread-safe user pool keyed by user ID
 type UserPool struct {
-	mutex sync.RWMutex
-	users []plugin.UserContext
+	mutex     sync.RWMutex
+	users     map[uint]plugin.UserContext
+	instances map[uint]*Plugin
 }
 
-// AddUser adds a user context to the user pool
+// AddUser adds a user context to the user pool, replacing the existing one with the same ID
 func (c *UserPool) AddUser(ctx plugin.UserContext) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
 
-	c.users = append(c.users, ctx)
+	if c.users == nil {
+		c.users = make(map[uint]plugin.UserContext)
+	}
+	c.users[ctx.ID] = ctx
 }
 
-// GetUsersList retrieves a copy of the user pool
+// RemoveUser removes a user and its plugin instance from the user pool and returns the removed instance.
+// Gotify does not tell plugins about deleted users, so the plugin itself never removes users.
+func (c *UserPool) RemoveUser(id uint) (instance *Plugin) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	instance = c.instances[id]
+	delete(c.users, id)
+	delete(c.instances, id)
+	return instance
+}
+
+// SetInstance registers the plugin instance of a user and returns the instance it replaces
+func (c *UserPool) SetInstance(p *Plugin) (old *Plugin) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.instances == nil {
+		c.instances = make(map[uint]*Plugin)
+	}
+	old = c.instances[p.UserCtx.ID]
+	c.instances[p.UserCtx.ID] = p
+	return old
+}
+
+// GetInstance retrieves the plugin instance of a user
+func (c *UserPool) GetInstance(id uint) *Plugin {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.instances[id]
+}
+
+// GetUserByName retrieves a user by name
+func (c *UserPool) GetUserByName(name string) (plugin.UserContext, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	for _, user := range c.users {
+		if user.Name == name {
+			return user, true
+		}
+	}
+	return plugin.UserContext{}, false
+}
+
+// GetUsersList retrieves a copy of the user pool ordered by user ID
 func (c *UserPool) GetUsersList() []plugin.UserContext {
 	var res []plugin.UserContext
 	c.mutex.RLock()
 	defer c.mutex.RUnlock()
 
-	res = append(res, c.users...)
+	for _, user := range c.users {
+		res = append(res, user)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].ID < res[j].ID
+	})
 	return res
 }
@@ -18,6 +18,55 @@ func TestUserPool(t *testing.T) {
 			})
 			c.So(pool.GetUsersList(), ShouldHaveLength, 1)
 		})
+		c.Convey("Deduplicates users", func(c C) {
+			pool.AddUser(plugin.UserContext{
+				ID:   1,
+				Name: "test",
+			})
+			pool.AddUser(plugin.UserContext{
+				ID:   1,
+				Name: "test_renamed",
+			})
+			c.So(pool.GetUsersList(), ShouldResemble, []plugin.UserContext{{ID: 1, Name: "test_renamed"}})
+		})
+		c.Convey("Remove users", func(c C) {
+			pool.AddUser(plugin.UserContext{
+				ID:   1,
+				Name: "test",
+			})
+			pool.AddUser(plugin.UserContext{
+				ID:   2,
+				Name: "test_2",
+			})
+			pool.RemoveUser(1)
+			c.So(pool.GetUsersList(), ShouldResemble, []plugin.UserContext{{ID: 2, Name: "test_2"}})
+		})
+		c.Convey("Remove test users from the server", func(c C) {
+			id := nextTestUserID()
+			p := NewGotifyPluginInstance(plugin.UserContext{ID: id, Name: "removed", Admin: true}).(*Plugin)
+			p.SetStorageHandler(new(memoryStorage))
+			config := p.DefaultConfig().(*Config)
+			config.Channels = []ChannelDef{{Name: "news", Public: true}}
+			config.Subscriptions = []string{"removed/news"}
+			config.ServerQuota = Quota{PerMinute: 1}
+			c.So(p.ValidateAndSetConfig(config), ShouldBeNil)
+			c.So(serverQuota.ceilings, ShouldContainKey, id)
+			c.So(publicChannels.SubscriberCount(p.UserCtx, "news"), ShouldEqual, 1)
+
+			removeTestUser(id)
+			c.So(usersList.GetInstance(id), ShouldBeNil)
+			c.So(msgExchanger.Stats(id), ShouldResemble, DeliveryStats{})
+			for _, channel := range publicChannels.GetAllChannels() {
+				c.So(channel.UserContext.ID, ShouldNotEqual, id)
+			}
+			c.So(publicChannels.SubscriberCount(p.UserCtx, "news"), ShouldEqual, 0)
+			c.So(serverQuota.ceilings, ShouldNotContainKey, id)
+			select {
+			case <-p.stop:
+			default:
+				c.So("instance not torn down", ShouldBeEmpty)
+			}
+		})
 	})
 
 }
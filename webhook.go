@@ -2,46 +2,286 @@ package main
 
 import (
 	"errors"
+	"math"
+	"strconv"
+	"time"
 
+	"github.com/eternal-flame-AD/gotify-broadcast/model"
 	"github.com/gotify/plugin-api"
 
 	"github.com/gin-gonic/gin"
 )
 
-func (c *Plugin) hasChannel(channel string) bool {
-	for _, ch := range c.config.Channels {
+func (c *Plugin) getChannel(channel string) (ChannelDef, bool) {
+	for _, ch := range c.loadState().config.Channels {
 		if ch.Name == channel {
-			return true
+			return ch, true
 		}
 	}
-	return false
+	return ChannelDef{}, false
 }
 
 type message struct {
 	Message  string                 `json:"message" query:"message" form:"message"`
 	Title    string                 `json:"title" query:"title" form:"title"`
-	Priority int                    `json:"priority" query:"priority" form:"priority"`
+	Priority *int                   `json:"priority" query:"priority" form:"priority"`
 	Extras   map[string]interface{} `json:"extras" query:"-" form:"-"`
+	DedupKey string                 `json:"dedup_key" query:"dedup_key" form:"dedup_key"`
+	SendAt   time.Time              `json:"send_at" query:"send_at" form:"send_at" time_format:"2006-01-02T15:04:05Z07:00"`
+	Cron     string                 `json:"cron" query:"cron" form:"cron"`
+	TTL      string                 `json:"ttl" query:"ttl" form:"ttl"`
 }
 
 // RegisterWebhook implements plugin.Webhooker
 func (c *Plugin) RegisterWebhook(basePath string, mux *gin.RouterGroup) {
 	c.basePath = basePath
-	mux.POST("/message", func(ctx *gin.Context) {
-		channel := ctx.Query("channel")
-		if !c.hasChannel(channel) {
-			_ = ctx.AbortWithError(400, errors.New("channel not found"))
-			return
-		}
-		msg := new(message)
-		if err := ctx.Bind(msg); err == nil {
-			c.sendMessage(plugin.Message{
-				Message:  msg.Message,
-				Title:    msg.Title,
-				Priority: msg.Priority,
-				Extras:   msg.Extras,
-			}, channel)
-			ctx.JSON(200, msg)
-		}
-	})
+	mux.POST("/message", c.handleMessage)
+	mux.GET("/channels", c.handleListChannels)
+	mux.GET("/scheduled", c.handleListScheduled)
+	mux.DELETE("/scheduled/:id", c.handleCancelScheduled)
+	mux.POST("/invites", c.handleCreateInvite)
+	mux.GET("/invites", c.handleListInvites)
+	mux.DELETE("/invites/:token", c.handleRevokeInvite)
+	mux.DELETE("/members", c.handleRemoveMember)
+	mux.POST("/join", c.handleJoin)
+	mux.GET("/moderation", c.handleListPending)
+	mux.GET("/moderation/:id/approve", c.handleModerate(true))
+	mux.GET("/moderation/:id/reject", c.handleModerate(false))
+}
+
+func (c *Plugin) handleMessage(ctx *gin.Context) {
+	owner, channel, err := c.resolveChannel(ctx.Query("channel"))
+	switch err {
+	case nil:
+	case errNotPoster:
+		_ = ctx.AbortWithError(403, err)
+		return
+	default:
+		_ = ctx.AbortWithError(400, err)
+		return
+	}
+	msg := new(message)
+	if err := ctx.Bind(msg); err != nil {
+		return
+	}
+	var ttl time.Duration
+	if msg.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(msg.TTL); err != nil || ttl <= 0 {
+			_ = ctx.AbortWithError(400, errors.New("ttl must be a positive duration"))
+			return
+		}
+	}
+	pluginMsg := applyChannelDefaults(channel, plugin.Message{
+		Message: msg.Message,
+		Title:   msg.Title,
+		Extras:  msg.Extras,
+	}, msg.Priority)
+	key := ctx.GetHeader("Idempotency-Key")
+	if key == "" {
+		key = msg.DedupKey
+	}
+	if !msg.SendAt.IsZero() || msg.Cron != "" {
+		job, err := newScheduledBroadcast(ctx.Query("channel"), pluginMsg, msg.SendAt, msg.Cron, ttl)
+		if err != nil {
+			_ = ctx.AbortWithError(400, err)
+			return
+		}
+		schedule := func() (ScheduledBroadcast, error) {
+			return job, c.scheduleBroadcast(job)
+		}
+		if key != "" {
+			job, _, err = c.scheduleBroadcastOnce(owner.UserCtx, channel, key, schedule)
+		} else {
+			job, err = schedule()
+		}
+		if err != nil {
+			_ = ctx.AbortWithError(500, err)
+			return
+		}
+		ctx.JSON(202, job)
+		return
+	}
+
+	broadcast := c.newBroadcast(pluginMsg, channel, model.OriginWebhook)
+	broadcast.ChannelOwner = owner.UserCtx
+	broadcast.SourceIP = ctx.ClientIP()
+	broadcast.UserAgent = ctx.Request.UserAgent()
+	if ttl > 0 {
+		broadcast.ExpiresAt = broadcast.Timestamp.Add(ttl)
+	}
+	if channel.Moderated && owner != c {
+		// proposals are only counted against the quota once they are approved
+		if err := owner.enforceQuota(channel, broadcast, false); err != nil {
+			abortWithQuotaError(ctx, err)
+			return
+		}
+		pending, err := owner.submitForApproval(channel, broadcast)
+		switch err {
+		case nil:
+		case errTooManyPending:
+			_ = ctx.AbortWithError(429, err)
+			return
+		default:
+			_ = ctx.AbortWithError(500, err)
+			return
+		}
+		ctx.JSON(202, gin.H{"id": pending.ID, "expires": pending.Expires})
+		return
+	}
+	send := func() (*DeliveryReport, error) {
+		if err := owner.enforceQuota(channel, broadcast, true); err != nil {
+			return nil, err
+		}
+		return owner.sendMessage(channel, broadcast), nil
+	}
+	var report *DeliveryReport
+	if key != "" {
+		report, _, err = c.sendMessageOnce(owner.UserCtx, channel, key, send)
+	} else {
+		report, err = send()
+	}
+	if err != nil {
+		abortWithQuotaError(ctx, err)
+		return
+	}
+	if !channel.ReportRecipients {
+		ctx.JSON(200, report.redacted())
+		return
+	}
+	ctx.JSON(200, report)
+}
+
+// publicChannel is a public channel listed by the channels endpoint
+type publicChannel struct {
+	Owner       string   `json:"owner"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	Subscribers int      `json:"subscribers"`
+}
+
+// handleListChannels lists the public channels on the server, only those named channel or below it if channel is given
+func (c *Plugin) handleListChannels(ctx *gin.Context) {
+	channels := publicChannels.GetAllChannels()
+	if root := ctx.Query("channel"); root != "" {
+		channels = publicChannels.GetSubtree(root)
+	}
+	res := make([]publicChannel, 0, len(channels))
+	for _, channel := range channels {
+		res = append(res, publicChannel{
+			Owner:       channel.UserContext.Name,
+			Name:        channel.Channel.Name,
+			Description: channel.Channel.Description,
+			Tags:        channel.Channel.Tags,
+			Subscribers: publicChannels.SubscriberCount(channel.UserContext, channel.Channel.Name),
+		})
+	}
+	ctx.JSON(200, res)
+}
+
+// abortWithQuotaError responds to a broadcast refused by enforceQuota
+func abortWithQuotaError(ctx *gin.Context, err error) {
+	switch err := err.(type) {
+	case errRateLimited:
+		ctx.Header("Retry-After", strconv.Itoa(int(math.Ceil(err.retryAfter.Seconds()))))
+		_ = ctx.AbortWithError(429, err)
+	case errTooManyRecipients:
+		_ = ctx.AbortWithError(403, err)
+	default:
+		_ = ctx.AbortWithError(500, err)
+	}
+}
+
+func (c *Plugin) handleListScheduled(ctx *gin.Context) {
+	ctx.JSON(200, c.listScheduled(ctx.Query("channel")))
+}
+
+func (c *Plugin) handleCancelScheduled(ctx *gin.Context) {
+	if !c.cancelScheduled(ctx.Param("id")) {
+		_ = ctx.AbortWithError(404, errors.New("scheduled broadcast not found"))
+		return
+	}
+	ctx.Status(204)
+}
+
+type inviteRequest struct {
+	TTL     string `json:"ttl" query:"ttl" form:"ttl"`
+	MaxUses int    `json:"max_uses" query:"max_uses" form:"max_uses"`
+}
+
+func (c *Plugin) handleCreateInvite(ctx *gin.Context) {
+	req := new(inviteRequest)
+	if err := ctx.Bind(req); err != nil {
+		return
+	}
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil {
+			_ = ctx.AbortWithError(400, err)
+			return
+		}
+	}
+	invite, err := c.createInvite(ctx.Query("channel"), ttl, req.MaxUses)
+	if err != nil {
+		_ = ctx.AbortWithError(400, err)
+		return
+	}
+	ctx.JSON(201, invite)
+}
+
+func (c *Plugin) handleListInvites(ctx *gin.Context) {
+	ctx.JSON(200, c.listInvites(ctx.Query("channel")))
+}
+
+func (c *Plugin) handleRevokeInvite(ctx *gin.Context) {
+	if !c.revokeInvite(ctx.Param("token")) {
+		_ = ctx.AbortWithError(404, errors.New("invite not found"))
+		return
+	}
+	ctx.Status(204)
+}
+
+func (c *Plugin) handleRemoveMember(ctx *gin.Context) {
+	if !c.removeMember(ctx.Query("channel"), ctx.Query("user")) {
+		_ = ctx.AbortWithError(404, errors.New("member not found"))
+		return
+	}
+	ctx.Status(204)
+}
+
+func (c *Plugin) handleJoin(ctx *gin.Context) {
+	switch err := c.joinChannel(ctx.Query("channel"), ctx.Query("token")); err {
+	case nil:
+		ctx.Status(204)
+	case errInvalidInvite:
+		_ = ctx.AbortWithError(403, err)
+	default:
+		_ = ctx.AbortWithError(400, err)
+	}
+}
+
+func (c *Plugin) handleListPending(ctx *gin.Context) {
+	ctx.JSON(200, c.listPending())
+}
+
+func (c *Plugin) handleModerate(approve bool) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		report, err := c.moderate(ctx.Param("id"), ctx.Query("token"), approve)
+		switch err {
+		case nil:
+		case errPendingNotFound, errChannelNotFound:
+			_ = ctx.AbortWithError(404, err)
+			return
+		default:
+			abortWithQuotaError(ctx, err)
+			return
+		}
+		if !approve {
+			ctx.String(200, "The broadcast is rejected.")
+			return
+		}
+		ctx.String(200, "The broadcast is approved and delivered to %d recipients.", report.Counts[StatusDelivered])
+	}
 }
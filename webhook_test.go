@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	plugin "github.com/gotify/plugin-api"
+
+	. "github.com/smartystreets/goconvey/convey"
+)
+
+func newTestWebhook(p *Plugin) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	p.RegisterWebhook("/plugin/1/custom/token/", engine.Group("/"))
+	return engine
+}
+
+func postJSON(engine *gin.Engine, path string, body string, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	return w
+}
+
+func request(engine *gin.Engine, method string, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+func TestChannelsWebhook(t *testing.T) {
+	Convey("Test Channels Webhook", t, func(c C) {
+		p, _ := newTestUser(c, "hierarchy", func(config *Config) {
+			config.Channels = []ChannelDef{
+				{Name: "ops.db", Public: true},
+				{Name: "ops.web", Public: true, Description: "web servers"},
+				{Name: "opsx", Public: true},
+				{Name: "ops.secret"},
+			}
+		})
+		engine := newTestWebhook(p)
+		list := func(path string) []string {
+			w := request(engine, "GET", path)
+			c.So(w.Code, ShouldEqual, http.StatusOK)
+			var channels []publicChannel
+			c.So(json.Unmarshal(w.Body.Bytes(), &channels), ShouldBeNil)
+			var res []string
+			for _, channel := range channels {
+				if channel.Owner == "hierarchy" {
+					res = append(res, channel.Name)
+				}
+			}
+			return res
+		}
+		c.So(list("/channels"), ShouldResemble, []string{"ops.db", "ops.web", "opsx"})
+		c.So(list("/channels?channel=ops"), ShouldResemble, []string{"ops.db", "ops.web"})
+		c.So(list("/channels?channel=ops.web"), ShouldResemble, []string{"ops.web"})
+	})
+}
+
+func TestMessageWebhook(t *testing.T) {
+	Convey("Test Message Webhook", t, func(c C) {
+		p := &Plugin{UserCtx: plugin.UserContext{ID: 5001, Name: "webhook"}}
+		config := p.DefaultConfig().(*Config)
+		c.So(p.ValidateAndSetConfig(config), ShouldBeNil)
+		engine := newTestWebhook(p)
+
+		c.Convey("rejects unknown channel", func(c C) {
+			w := postJSON(engine, "/message?channel=nonexistent", `{"message": "hello"}`, nil)
+			c.So(w.Code, ShouldEqual, http.StatusBadRequest)
+		})
+		c.Convey("returns a delivery report", func(c C) {
+			w := postJSON(engine, "/message?channel=example", `{"message": "hello"}`, nil)
+			c.So(w.Code, ShouldEqual, http.StatusOK)
+			report := new(DeliveryReport)
+			c.So(json.Unmarshal(w.Body.Bytes(), report), ShouldBeNil)
+			c.So(report.ID, ShouldNotBeEmpty)
+			c.So(report.Recipients, ShouldBeEmpty)
+		})
+		c.Convey("suppresses retries with the same idempotency key", func(c C) {
+			reports := make([]DeliveryReport, 3)
+			for i, req := range []struct {
+				body   string
+				header map[string]string
+			}{
+				{`{"message": "hello"}`, map[string]string{"Idempotency-Key": "retry"}},
+				{`{"message": "hello"}`, map[string]string{"Idempotency-Key": "retry"}},
+				{`{"message": "hello", "dedup_key": "retry"}`, nil},
+			} {
+				w := postJSON(engine, "/message?channel=example", req.body, req.header)
+				c.So(w.Code, ShouldEqual, http.StatusOK)
+				c.So(json.Unmarshal(w.Body.Bytes(), &reports[i]), ShouldBeNil)
+			}
+			c.So(reports[1].ID, ShouldEqual, reports[0].ID)
+			c.So(reports[2].ID, ShouldEqual, reports[0].ID)
+
+			w := postJSON(engine, "/message?channel=example", `{"message": "hello"}`, map[string]string{"Idempotency-Key": "another"})
+			report := new(DeliveryReport)
+			c.So(json.Unmarshal(w.Body.Bytes(), report), ShouldBeNil)
+			c.So(report.ID, ShouldNotEqual, reports[0].ID)
+		})
+		c.Convey("schedules broadcasts", func(c C) {
+			w := postJSON(engine, "/message?channel=example", `{"message": "hello", "send_at": "2099-01-01T00:00:00Z"}`, nil)
+			c.So(w.Code, ShouldEqual, http.StatusAccepted)
+			job := new(ScheduledBroadcast)
+			c.So(json.Unmarshal(w.Body.Bytes(), job), ShouldBeNil)
+			w = postJSON(engine, "/message?channel=example", `{"message": "hello", "cron": "0 9 * * 1"}`, nil)
+			c.So(w.Code, ShouldEqual, http.StatusAccepted)
+			w = postJSON(engine, "/message?channel=example", `{"message": "hello", "cron": "0 9 * *"}`, nil)
+			c.So(w.Code, ShouldEqual, http.StatusBadRequest)
+
+			w = request(engine, "GET", "/scheduled?channel=example")
+			c.So(w.Code, ShouldEqual, http.StatusOK)
+			var jobs []ScheduledBroadcast
+			c.So(json.Unmarshal(w.Body.Bytes(), &jobs), ShouldBeNil)
+			c.So(jobs, ShouldHaveLength, 2)
+			c.So(jobs[1].ID, ShouldEqual, job.ID)
+
+			c.So(request(engine, "DELETE", "/scheduled/"+job.ID).Code, ShouldEqual, http.StatusNoContent)
+			c.So(request(engine, "DELETE", "/scheduled/"+job.ID).Code, ShouldEqual, http.StatusNotFound)
+			c.So(p.listScheduled("example"), ShouldHaveLength, 1)
+		})
+		c.Convey("schedules retries with the same idempotency key once", func(c C) {
+			header := map[string]string{"Idempotency-Key": "scheduled"}
+			first := postJSON(engine, "/message?channel=example", `{"message": "hello", "cron": "0 9 * * 1"}`, header)
+			c.So(first.Code, ShouldEqual, http.StatusAccepted)
+			retry := postJSON(engine, "/message?channel=example", `{"message": "hello", "cron": "0 9 * * 1"}`, header)
+			c.So(retry.Code, ShouldEqual, http.StatusAccepted)
+			c.So(retry.Body.String(), ShouldEqual, first.Body.String())
+			c.So(p.listScheduled("example"), ShouldHaveLength, 1)
+
+			w := postJSON(engine, "/message?channel=example", `{"message": "hello"}`, header)
+			c.So(w.Code, ShouldEqual, http.StatusOK)
+		})
+	})
+}